@@ -0,0 +1,131 @@
+package imapsrv
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// imapDateTimeLayout is the RFC 3501 date-time format used by APPEND's
+// optional internal date argument, e.g. "02-Jan-2006 15:04:05 -0700"
+const imapDateTimeLayout = "02-Jan-2006 15:04:05 -0700"
+
+// MailstoreWriter is implemented by Mailstores that accept new messages,
+// e.g. via the APPEND command
+type MailstoreWriter interface {
+	// Append stores a new message in mbox, returning its assigned UID
+	Append(mbox *Mailbox, flags []string, internalDate time.Time, body io.Reader) (uid int64, err error)
+}
+
+// appendCommand is the APPEND command. Its literal body is not buffered
+// into the command at parse time - execute() streams it directly out of
+// the lexer and into the Mailstore, since appended messages may be too
+// large to hold in memory.
+type appendCommand struct {
+	tag          string
+	mailboxPath  []string
+	flags        []string
+	internalDate time.Time
+	length       int64
+	nonSync      bool
+	lexer        *lexer
+}
+
+// createAppend parses an APPEND command
+func (p *parser) createAppend(tag string) (command, error) {
+
+	mailbox := p.lexer.next(asAString).value
+
+	var flags []string
+	p.lexer.skipSpace()
+	if p.lexer.current == leftParenthesis {
+		p.lexer.consume()
+		for p.lexer.current != rightParenthesis {
+			flags = append(flags, p.lexer.next(asFlag).value)
+			p.lexer.skipSpace()
+		}
+		p.lexer.consume() // consume the ')'
+	}
+
+	var dateArg string
+	p.lexer.skipSpace()
+	if p.lexer.current == doubleQuote {
+		p.lexer.consume()
+		dateArg = p.lexer.qstring().value
+		p.lexer.skipSpace()
+	}
+
+	if p.lexer.current != leftCurly {
+		return nil, parseError("APPEND expected a literal message argument")
+	}
+	p.lexer.consume() // consume the '{'
+	length, nonSync := p.lexer.literalHeader()
+
+	internalDate := time.Now()
+	if dateArg != "" {
+		if t, err := time.Parse(imapDateTimeLayout, dateArg); err == nil {
+			internalDate = t
+		}
+	}
+
+	return &appendCommand{
+		tag:          tag,
+		mailboxPath:  strings.Split(mailbox, "/"),
+		flags:        flags,
+		internalDate: internalDate,
+		length:       length,
+		nonSync:      nonSync,
+		lexer:        p.lexer,
+	}, nil
+}
+
+func (c *appendCommand) execute(sess *session) *response {
+
+	if resp := sess.requireState(c.tag, authenticated); resp != nil {
+		c.lexer.streamLiteral(c.length, io.Discard)
+		return resp
+	}
+
+	writer, canWrite := sess.store().(MailstoreWriter)
+	if !canWrite {
+		c.lexer.streamLiteral(c.length, io.Discard)
+		return bad(c.tag, "APPEND is not supported by this mailstore")
+	}
+
+	mbox, err := sess.store().GetMailbox(c.mailboxPath)
+	if err != nil {
+		c.lexer.streamLiteral(c.length, io.Discard)
+		return no(c.tag, err.Error())
+	}
+	if mbox == nil {
+		c.lexer.streamLiteral(c.length, io.Discard)
+		return no(c.tag, "[TRYCREATE] No such mailbox")
+	}
+
+	// A synchronizing literal requires the server to request the data
+	// before the client sends it. Non-synchronizing ({N+}) literals are
+	// sent unconditionally, so no continuation is needed.
+	if !c.nonSync && sess.conn != nil {
+		fmt.Fprint(sess.conn, "+ Ready for literal data\r\n")
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(c.lexer.streamLiteral(c.length, pw))
+	}()
+
+	uid, err := writer.Append(mbox, c.flags, c.internalDate, pr)
+	if err != nil {
+		// Append may reject the message (e.g. a quota check) without
+		// reading body to EOF. Drain whatever is left so the
+		// streamLiteral goroutine can finish and the lexer is left
+		// positioned after the literal for the next command.
+		io.Copy(io.Discard, pr)
+		return no(c.tag, err.Error())
+	}
+
+	resp := ok(c.tag, "APPEND completed")
+	resp.extra(fmt.Sprintf("OK [APPENDUID %d %d] APPEND completed", mbox.Id, uid))
+	return resp
+}
@@ -0,0 +1,91 @@
+package imapsrv
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writerMailstore records Append calls on top of TestMailstore's dummy
+// behaviour
+type writerMailstore struct {
+	TestMailstore
+	uid   int64
+	flags []string
+	body  string
+}
+
+func (m *writerMailstore) Append(mbox *Mailbox, flags []string, internalDate time.Time, body io.Reader) (int64, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return 0, err
+	}
+	m.flags = flags
+	m.body = string(data)
+	m.uid = 42
+	return m.uid, nil
+}
+
+// TestAppendCommand tests that APPEND streams a literal message body
+// through to the Mailstore intact
+func TestAppendCommand(t *testing.T) {
+	store := &writerMailstore{}
+	s := NewServer(Store(store))
+	sess := createSession("1", s.config, s, nil, nil)
+	sess.st = authenticated
+
+	serverConn, clientConn := net.Pipe()
+	sess.conn = serverConn
+
+	const msg = "Subject: hi\r\n\r\nhello world\r\n"
+	raw := "A01 APPEND inbox (\\Seen) {" + itoa(len(msg)) + "}\r\n" + msg + "\r\n"
+
+	clientDone := make(chan struct{})
+	go func() {
+		defer close(clientDone)
+		r := bufio.NewReader(clientConn)
+		line, err := r.ReadString('\n')
+		if err != nil || strings.TrimSpace(line) != "+ Ready for literal data" {
+			t.Errorf("expected a literal continuation request, got %q (err %v)", line, err)
+		}
+	}()
+
+	p := createParser(bufio.NewReader(strings.NewReader(raw)))
+	cmd, err := p.next()
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	resp := cmd.execute(sess)
+	<-clientDone
+
+	if resp.status != statusOk {
+		t.Fatalf("APPEND failed: %+v", resp)
+	}
+	if store.body != msg {
+		t.Fatalf("Mailstore received %q, want %q", store.body, msg)
+	}
+	if len(store.flags) != 1 || store.flags[0] != "\\Seen" {
+		t.Fatalf("unexpected flags passed to Append: %v", store.flags)
+	}
+	if !strings.Contains(resp.untagged[0], "APPENDUID 1 42") {
+		t.Fatalf("unexpected APPENDUID response: %q", resp.untagged[0])
+	}
+}
+
+func itoa(n int) string {
+	if n == 0 {
+		return "0"
+	}
+	var buf [20]byte
+	i := len(buf)
+	for n > 0 {
+		i--
+		buf[i] = byte('0' + n%10)
+		n /= 10
+	}
+	return string(buf[i:])
+}
@@ -0,0 +1,138 @@
+package imapsrv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// authenticateCommand is the AUTHENTICATE command (RFC 4954)
+type authenticateCommand struct {
+	tag        string
+	mechName   string
+	initial    []byte
+	hasInitial bool
+}
+
+// createAuthenticate parses an AUTHENTICATE command
+func (p *parser) createAuthenticate(tag string) (command, error) {
+	mechName := strings.ToUpper(p.lexer.next(asAny).value)
+
+	var initial []byte
+	hasInitial := false
+	p.lexer.skipSpace()
+	if p.lexer.current != cr {
+		arg := p.lexer.next(asAString).value
+		hasInitial = true
+		if arg == "=" {
+			// RFC 4954 shorthand for an empty initial response
+			initial = []byte{}
+		} else {
+			decoded, err := base64.StdEncoding.DecodeString(arg)
+			if err != nil {
+				return nil, parseError("Invalid initial response")
+			}
+			initial = decoded
+		}
+	}
+	p.lexer.next(asAny) // consume the trailing EOL
+
+	return &authenticateCommand{tag: tag, mechName: mechName, initial: initial, hasInitial: hasInitial}, nil
+}
+
+func (c *authenticateCommand) execute(sess *session) *response {
+	if !sess.tls && !sess.config.AllowInsecureAuth {
+		return no(c.tag, "AUTHENTICATE requires a TLS-protected connection")
+	}
+	if sess.conn == nil || sess.reader == nil {
+		return bad(c.tag, "AUTHENTICATE requires a live connection")
+	}
+
+	factory, supported := sess.config.Mechanisms[c.mechName]
+	if !supported {
+		return no(c.tag, "Unsupported authentication mechanism")
+	}
+	mech := factory()
+
+	resp := c.initial
+	haveResp := c.hasInitial
+
+	for {
+		var clientResp []byte
+		if haveResp {
+			clientResp = resp
+		}
+
+		challenge, done, err := mech.Next(clientResp)
+		if err != nil {
+			return no(c.tag, err.Error())
+		}
+		if done {
+			return c.authenticated(sess, mech)
+		}
+
+		fmt.Fprintf(sess.conn, "+ %s\r\n", base64.StdEncoding.EncodeToString(challenge))
+
+		decoded, cancelled, err := readAuthResponse(sess)
+		if err != nil {
+			return bad(c.tag, err.Error())
+		}
+		if cancelled {
+			return bad(c.tag, "AUTHENTICATE cancelled")
+		}
+		resp = decoded
+		haveResp = true
+	}
+}
+
+// readAuthResponse reads a single AUTHENTICATE continuation response from
+// sess.reader. Per RFC 4954, the response may be sent either as a plain
+// base64 line or as an IMAP literal (whose contents are still base64
+// text) - a fresh lexer over sess.reader handles both the same way the
+// initial response does at parse time.
+func readAuthResponse(sess *session) (decoded []byte, cancelled bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(parseError); ok {
+				err = parseError("AUTHENTICATE aborted")
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	lex := createLexer(sess.reader)
+	tok := lex.next(asAny)
+	if tok.tokType == eolTokenType {
+		return nil, false, parseError("AUTHENTICATE aborted")
+	}
+	lex.next(asAny) // consume the trailing EOL
+
+	if tok.value == "*" {
+		return nil, true, nil
+	}
+
+	decoded, decErr := base64.StdEncoding.DecodeString(tok.value)
+	if decErr != nil {
+		return nil, false, parseError("Invalid base64 response")
+	}
+	return decoded, false, nil
+}
+
+// authenticated binds the identity mech validated to the session, via
+// config.Authenticator if one is configured
+func (c *authenticateCommand) authenticated(sess *session, mech SASLMechanism) *response {
+	if sess.config.Authenticator != nil {
+		identity := ""
+		if iv, ok := mech.(identityVerifier); ok {
+			identity = iv.Identity()
+		}
+		store, err := sess.config.Authenticator.Authenticate(identity)
+		if err != nil {
+			return no(c.tag, err.Error())
+		}
+		sess.authStore = store
+	}
+	sess.st = authenticated
+	return ok(c.tag, "AUTHENTICATE completed")
+}
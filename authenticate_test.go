@@ -0,0 +1,102 @@
+package imapsrv
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func plainValidator(wantUser, wantPass string) func(authzid, authcid, password string) error {
+	return func(authzid, authcid, password string) error {
+		if authcid != wantUser || password != wantPass {
+			return fmt.Errorf("invalid credentials")
+		}
+		return nil
+	}
+}
+
+// TestAuthenticatePlainLiteralResponse tests that a continuation response
+// sent as an IMAP literal (rather than a single base64 line) is accepted
+func TestAuthenticatePlainLiteralResponse(t *testing.T) {
+	m := &TestMailstore{}
+	s := NewServer(
+		Store(m),
+		AllowInsecureAuth(),
+		SASL(NewPlainMechanism(plainValidator("user", "pass"))),
+	)
+	sess := createSession("1", s.config, s, nil, nil)
+
+	serverConn, clientConn := net.Pipe()
+	sess.conn = serverConn
+	sess.reader = bufio.NewReader(serverConn)
+
+	done := make(chan *response, 1)
+	go func() {
+		cmd := &authenticateCommand{tag: "A01", mechName: "PLAIN"}
+		done <- cmd.execute(sess)
+	}()
+
+	clientReader := bufio.NewReader(clientConn)
+	challenge, err := clientReader.ReadString('\n')
+	if err != nil || challenge[0] != '+' {
+		t.Fatalf("expected a continuation challenge, got %q (err %v)", challenge, err)
+	}
+
+	saslResp := "\x00user\x00pass"
+	b64 := base64.StdEncoding.EncodeToString([]byte(saslResp))
+	literal := fmt.Sprintf("{%d}\r\n%s\r\n", len(b64), b64)
+	if _, err := clientConn.Write([]byte(literal)); err != nil {
+		t.Fatalf("failed to write literal response: %v", err)
+	}
+
+	select {
+	case resp := <-done:
+		if resp.tag != "A01" || resp.message != "AUTHENTICATE completed" {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("AUTHENTICATE did not complete after the literal response")
+	}
+}
+
+// TestAuthenticateCancel tests that a client that sends "*" cancels the
+// exchange
+func TestAuthenticateCancel(t *testing.T) {
+	m := &TestMailstore{}
+	s := NewServer(
+		Store(m),
+		AllowInsecureAuth(),
+		SASL(NewPlainMechanism(plainValidator("user", "pass"))),
+	)
+	sess := createSession("1", s.config, s, nil, nil)
+
+	serverConn, clientConn := net.Pipe()
+	sess.conn = serverConn
+	sess.reader = bufio.NewReader(serverConn)
+
+	done := make(chan *response, 1)
+	go func() {
+		cmd := &authenticateCommand{tag: "A01", mechName: "PLAIN"}
+		done <- cmd.execute(sess)
+	}()
+
+	clientReader := bufio.NewReader(clientConn)
+	if _, err := clientReader.ReadString('\n'); err != nil {
+		t.Fatalf("expected a continuation challenge: %v", err)
+	}
+	if _, err := clientConn.Write([]byte("*\r\n")); err != nil {
+		t.Fatalf("failed to write cancellation: %v", err)
+	}
+
+	select {
+	case resp := <-done:
+		if resp.status != statusBad {
+			t.Fatalf("expected a BAD response after cancellation, got %+v", resp)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("AUTHENTICATE did not abort after cancellation")
+	}
+}
@@ -0,0 +1,239 @@
+package imapsrv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// mimePart is a single part of a parsed MIME tree. It holds the part's
+// still-encoded body bytes (as they would be transmitted on the wire),
+// which is what BODYSTRUCTURE's octet counts and BODY[n] section
+// extraction operate on.
+type mimePart struct {
+	header   textproto.MIMEHeader
+	body     []byte
+	children []*mimePart // populated for multipart/* parts
+	nested   *mimePart   // populated for message/rfc822 parts
+}
+
+// loadMime reads msg's raw RFC 822 bytes and parses them into a MIME tree
+func loadMime(msg Message) (*mimePart, error) {
+	raw, err := msg.Raw()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(raw)
+	if err != nil {
+		return nil, err
+	}
+	return parseMimeMessage(data)
+}
+
+// parseMimeMessage parses a single RFC 822 message (top-level or nested
+// via message/rfc822) into a mimePart tree
+func parseMimeMessage(raw []byte) (*mimePart, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(m.Body)
+	if err != nil {
+		return nil, err
+	}
+	part := &mimePart{header: textproto.MIMEHeader(m.Header), body: body}
+	if err := expandMime(part); err != nil {
+		return nil, err
+	}
+	return part, nil
+}
+
+// expandMime recursively expands a multipart or message/rfc822 part's
+// body into its children
+func expandMime(part *mimePart) error {
+	mediatype, params, err := mime.ParseMediaType(part.header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(mediatype, "multipart/"):
+		mr := multipart.NewReader(bytes.NewReader(part.body), params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			childBody, err := io.ReadAll(p)
+			if err != nil {
+				return err
+			}
+			child := &mimePart{header: p.Header, body: childBody}
+			if err := expandMime(child); err != nil {
+				return err
+			}
+			part.children = append(part.children, child)
+		}
+	case mediatype == "message/rfc822":
+		nested, err := parseMimeMessage(part.body)
+		if err == nil {
+			part.nested = nested
+		}
+	}
+	return nil
+}
+
+// buildBodyStructure renders part as an RFC 3501 BODY/BODYSTRUCTURE
+// parenthesized list
+func buildBodyStructure(part *mimePart) string {
+	mediatype, params, err := mime.ParseMediaType(part.header.Get("Content-Type"))
+	if err != nil {
+		mediatype, params = "text/plain", map[string]string{}
+	}
+
+	typ, subtype := "TEXT", "PLAIN"
+	if idx := strings.IndexByte(mediatype, '/'); idx >= 0 {
+		typ, subtype = mediatype[:idx], mediatype[idx+1:]
+	}
+
+	if strings.EqualFold(typ, "multipart") {
+		var b strings.Builder
+		b.WriteByte('(')
+		for _, child := range part.children {
+			b.WriteString(buildBodyStructure(child))
+		}
+		fmt.Fprintf(&b, " %s)", imapQuote(strings.ToUpper(subtype)))
+		return b.String()
+	}
+
+	encoding := part.header.Get("Content-Transfer-Encoding")
+	if encoding == "" {
+		encoding = "7BIT"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "(%s %s %s %s %s %s %d",
+		imapQuote(strings.ToUpper(typ)),
+		imapQuote(strings.ToUpper(subtype)),
+		paramList(params),
+		nilOrQuote(part.header.Get("Content-Id")),
+		nilOrQuote(part.header.Get("Content-Description")),
+		imapQuote(strings.ToUpper(encoding)),
+		len(part.body))
+
+	switch {
+	case strings.EqualFold(typ, "text"):
+		fmt.Fprintf(&b, " %d", countLines(part.body))
+	case strings.EqualFold(typ, "message") && strings.EqualFold(subtype, "rfc822") && part.nested != nil:
+		fmt.Fprintf(&b, " %s %s %d", buildEnvelope(part.nested.header),
+			buildBodyStructure(part.nested), countLines(part.nested.body))
+	}
+
+	b.WriteByte(')')
+	return b.String()
+}
+
+// buildEnvelope renders h as an RFC 3501 ENVELOPE parenthesized list
+func buildEnvelope(h textproto.MIMEHeader) string {
+	from := addressList(h.Get("From"))
+	sender := from
+	if s := h.Get("Sender"); s != "" {
+		sender = addressList(s)
+	}
+	replyTo := from
+	if r := h.Get("Reply-To"); r != "" {
+		replyTo = addressList(r)
+	}
+
+	return fmt.Sprintf("(%s %s %s %s %s %s %s %s %s %s)",
+		nilOrQuote(h.Get("Date")),
+		nilOrQuote(h.Get("Subject")),
+		from,
+		sender,
+		replyTo,
+		addressList(h.Get("To")),
+		addressList(h.Get("Cc")),
+		addressList(h.Get("Bcc")),
+		nilOrQuote(h.Get("In-Reply-To")),
+		nilOrQuote(h.Get("Message-Id")))
+}
+
+// addressList renders an address header value as an ENVELOPE address list
+func addressList(raw string) string {
+	if raw == "" {
+		return "NIL"
+	}
+	addrs, err := mail.ParseAddressList(raw)
+	if err != nil || len(addrs) == 0 {
+		return "NIL"
+	}
+
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, a := range addrs {
+		mailbox, host := a.Address, ""
+		if idx := strings.IndexByte(a.Address, '@'); idx >= 0 {
+			mailbox, host = a.Address[:idx], a.Address[idx+1:]
+		}
+		fmt.Fprintf(&b, "(%s NIL %s %s)", nilOrQuote(a.Name), imapQuote(mailbox), imapQuote(host))
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// paramList renders Content-Type parameters as an ENVELOPE/BODYSTRUCTURE
+// parameter list. Parameters are emitted in sorted key order so that
+// rendering the same part twice produces byte-identical output - Go's
+// map iteration order is randomized.
+func paramList(params map[string]string) string {
+	if len(params) == 0 {
+		return "NIL"
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s %s", imapQuote(strings.ToUpper(k)), imapQuote(params[k]))
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// nilOrQuote renders s as NIL if empty, or an IMAP quoted string
+func nilOrQuote(s string) string {
+	if s == "" {
+		return "NIL"
+	}
+	return imapQuote(s)
+}
+
+// imapQuote renders s as an IMAP quoted string
+func imapQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// countLines counts the newlines in b, as required for BODYSTRUCTURE's
+// text and message/rfc822 line counts
+func countLines(b []byte) int {
+	return bytes.Count(b, []byte("\n"))
+}
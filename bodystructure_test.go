@@ -0,0 +1,33 @@
+package imapsrv
+
+import "testing"
+
+// TestParamListDeterministic tests that paramList renders the same
+// output across repeated calls, regardless of Go's randomized map
+// iteration order
+func TestParamListDeterministic(t *testing.T) {
+	params := map[string]string{"charset": "utf-8", "boundary": "xyz", "format": "flowed"}
+	want := paramList(params)
+	for i := 0; i < 20; i++ {
+		if got := paramList(params); got != want {
+			t.Fatalf("paramList is not deterministic: got %q, want %q", got, want)
+		}
+	}
+}
+
+// TestRenderHeaderDeterministic tests that renderHeader renders the same
+// output across repeated calls
+func TestRenderHeaderDeterministic(t *testing.T) {
+	h := map[string][]string{
+		"Subject":    {"hi"},
+		"From":       {"a@example.com"},
+		"To":         {"b@example.com"},
+		"Message-Id": {"<1@example.com>"},
+	}
+	want := string(renderHeader(h, nil, false))
+	for i := 0; i < 20; i++ {
+		if got := string(renderHeader(h, nil, false)); got != want {
+			t.Fatalf("renderHeader is not deterministic: got %q, want %q", got, want)
+		}
+	}
+}
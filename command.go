@@ -0,0 +1,172 @@
+package imapsrv
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// command is anything that can be executed against a session to produce
+// a response
+type command interface {
+	execute(sess *session) *response
+}
+
+// parser turns a line-oriented IMAP client stream into commands
+type parser struct {
+	lexer *lexer
+}
+
+// createParser creates a parser reading from the given buffered reader
+func createParser(in *bufio.Reader) *parser {
+	return &parser{lexer: createLexer(in)}
+}
+
+// next reads and parses the next command from the client
+func (p *parser) next() (cmd command, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if pe, ok := r.(parseError); ok {
+				err = pe
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	tag := p.lexer.next(asTag).value
+	keyword := p.lexer.next(asAny).value
+
+	switch keyword {
+	case "CAPABILITY":
+		return &capability{tag: tag}, nil
+	case "LOGIN":
+		return p.createLogin(tag)
+	case "LOGOUT":
+		return &logout{tag: tag}, nil
+	case "SELECT":
+		return p.createSelect(tag, false)
+	case "EXAMINE":
+		return p.createSelect(tag, true)
+	case "APPEND":
+		return p.createAppend(tag)
+	case "SEARCH":
+		return p.createSearch(tag, false)
+	case "FETCH":
+		return p.createFetch(tag, false)
+	case "IDLE":
+		return p.createIdle(tag)
+	case "STARTTLS":
+		return p.createStarttls(tag)
+	case "AUTHENTICATE":
+		return p.createAuthenticate(tag)
+	case "CREATE":
+		return p.createCreate(tag)
+	case "DELETE":
+		return p.createDelete(tag)
+	case "RENAME":
+		return p.createRename(tag)
+	case "SUBSCRIBE":
+		return p.createSubscribe(tag)
+	case "UNSUBSCRIBE":
+		return p.createUnsubscribe(tag)
+	case "LIST":
+		return p.createList(tag, false)
+	case "LSUB":
+		return p.createList(tag, true)
+	case "STATUS":
+		return p.createStatus(tag)
+	case "UID":
+		return p.createUid(tag)
+	default:
+		p.lexer.consumeEol()
+		return nil, parseError(fmt.Sprintf("Unknown command %q", keyword))
+	}
+}
+
+// createUid parses the UID prefix, dispatching to the UID form of the
+// command that follows it
+func (p *parser) createUid(tag string) (command, error) {
+	sub := strings.ToUpper(p.lexer.next(asAny).value)
+
+	switch sub {
+	case "SEARCH":
+		return p.createSearch(tag, true)
+	case "FETCH":
+		return p.createFetch(tag, true)
+	default:
+		p.lexer.consumeEol()
+		return nil, parseError(fmt.Sprintf("Unknown UID command %q", sub))
+	}
+}
+
+// capability is the CAPABILITY command
+type capability struct {
+	tag string
+}
+
+func (c *capability) execute(sess *session) *response {
+	resp := ok(c.tag, "CAPABILITY completed")
+	line := "CAPABILITY IMAP4rev1"
+	if !sess.tls && sess.config.TLSConfig != nil {
+		line += " STARTTLS"
+	}
+	// Mechanisms are only worth advertising where AUTHENTICATE will
+	// actually be allowed to run
+	if sess.tls || sess.config.AllowInsecureAuth {
+		names := make([]string, 0, len(sess.config.Mechanisms))
+		for name := range sess.config.Mechanisms {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			line += " AUTH=" + name
+		}
+	}
+	resp.extra(line)
+	return resp
+}
+
+// login is the LOGIN command
+type login struct {
+	tag      string
+	userId   string
+	password string
+}
+
+func (p *parser) createLogin(tag string) (command, error) {
+	userId := p.lexer.next(asAString).value
+	password := p.lexer.next(asAString).value
+	p.lexer.next(asAny) // consume the trailing EOL
+	return &login{tag: tag, userId: userId, password: password}, nil
+}
+
+func (c *login) execute(sess *session) *response {
+	if !sess.tls && !sess.config.AllowInsecureAuth {
+		return no(c.tag, "LOGIN requires a TLS-protected connection")
+	}
+	if sess.config.LoginAuth == nil {
+		return no(c.tag, "LOGIN is not supported by this server")
+	}
+
+	store, err := sess.config.LoginAuth.Authenticate(c.userId, c.password)
+	if err != nil {
+		return no(c.tag, "LOGIN failed")
+	}
+
+	sess.authStore = store
+	sess.st = authenticated
+	return ok(c.tag, "LOGIN completed")
+}
+
+// logout is the LOGOUT command
+type logout struct {
+	tag string
+}
+
+func (c *logout) execute(sess *session) *response {
+	resp := ok(c.tag, "LOGOUT completed")
+	resp.extra("BYE IMAP4rev1 Server logging out")
+	return resp
+}
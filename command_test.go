@@ -2,6 +2,7 @@ package imapsrv
 
 import "testing"
 import "fmt"
+import "crypto/tls"
 
 func setupTest() (*Server, *session) {
 	m := &TestMailstore{}
@@ -10,6 +11,7 @@ func setupTest() (*Server, *session) {
 	)
 	//s.Start()
 	sess := createSession("1", s.config, s, nil, nil) // TODO: listener and net.Conn
+	sess.st = authenticated
 	return s, sess
 }
 
@@ -74,18 +76,93 @@ func (m *TestMailstore) NextUid(mbox int64) (int64, error) {
 	return 9, nil
 }
 
+// Search reports a dummy, empty result set
+func (m *TestMailstore) Search(mbox *Mailbox, crit *SearchCriteria, useUID bool) ([]int64, error) {
+	return nil, nil
+}
+
+// Fetch reports a dummy, empty message set
+func (m *TestMailstore) Fetch(mbox *Mailbox, set []SeqRange, useUID bool) ([]Message, error) {
+	return nil, nil
+}
+
+// CreateMailbox does nothing
+func (m *TestMailstore) CreateMailbox(path []string) error {
+	return nil
+}
+
+// DeleteMailbox does nothing
+func (m *TestMailstore) DeleteMailbox(path []string) error {
+	return nil
+}
+
+// RenameMailbox does nothing
+func (m *TestMailstore) RenameMailbox(from, to []string) error {
+	return nil
+}
+
+// Subscribe does nothing
+func (m *TestMailstore) Subscribe(path []string) error {
+	return nil
+}
+
+// Unsubscribe does nothing
+func (m *TestMailstore) Unsubscribe(path []string) error {
+	return nil
+}
+
+// ListMailboxes reports a dummy, empty mailbox list
+func (m *TestMailstore) ListMailboxes(reference []string, pattern string, subscribedOnly bool) ([]*Mailbox, error) {
+	return nil, nil
+}
+
+// Status reports dummy, empty status counts
+func (m *TestMailstore) Status(mbox *Mailbox, items []StatusItem) (map[StatusItem]int64, error) {
+	return nil, nil
+}
+
 // TestCapabilityCommand tests the correctness of the CAPABILITY command
+// for a server with no TLSConfig set, where STARTTLS is not available
 func TestCapabilityCommand(t *testing.T) {
 	_, session := setupTest()
 	cap := &capability{tag: "A00001"}
 	resp := cap.execute(session)
-	// TODO: STARTTLS shouldn't always be available? (i.e. after using STARTTLS)
+	if (resp.tag != "A00001") || (resp.message != "CAPABILITY completed") || (resp.untagged[0] != "CAPABILITY IMAP4rev1") {
+		t.Error("Capability Failed - unexpected response.")
+		fmt.Println(resp)
+	}
+}
+
+// TestCapabilityCommandWithTLS tests that CAPABILITY advertises STARTTLS
+// once the server is configured with a TLSConfig
+func TestCapabilityCommandWithTLS(t *testing.T) {
+	m := &TestMailstore{}
+	s := NewServer(Store(m), TLS(&tls.Config{}))
+	session := createSession("1", s.config, s, nil, nil)
+
+	cap := &capability{tag: "A00001"}
+	resp := cap.execute(session)
 	if (resp.tag != "A00001") || (resp.message != "CAPABILITY completed") || (resp.untagged[0] != "CAPABILITY IMAP4rev1 STARTTLS") {
 		t.Error("Capability Failed - unexpected response.")
 		fmt.Println(resp)
 	}
 }
 
+// TestCapabilityCommandAfterStarttls tests that CAPABILITY no longer
+// advertises STARTTLS once the session is already TLS-protected
+func TestCapabilityCommandAfterStarttls(t *testing.T) {
+	m := &TestMailstore{}
+	s := NewServer(Store(m), TLS(&tls.Config{}))
+	session := createSession("1", s.config, s, nil, nil)
+	session.tls = true
+
+	cap := &capability{tag: "A00001"}
+	resp := cap.execute(session)
+	if resp.untagged[0] != "CAPABILITY IMAP4rev1" {
+		t.Errorf("expected STARTTLS to no longer be advertised, got %q", resp.untagged[0])
+	}
+}
+
 // TestLogoutCommand tests the correctness of the LOGOUT command
 func TestLogoutCommand(t *testing.T) {
 	_, session := setupTest()
@@ -0,0 +1,85 @@
+package imapsrv
+
+import "crypto/tls"
+
+// Config holds the server-wide configuration assembled from Options
+type Config struct {
+	// Store is the Mailstore backing this server
+	Store Mailstore
+	// TLSConfig is used to negotiate STARTTLS, if set
+	TLSConfig *tls.Config
+	// AllowInsecureAuth permits LOGIN (and AUTHENTICATE) over a
+	// connection that isn't TLS-protected
+	AllowInsecureAuth bool
+	// Mechanisms holds the SASL mechanisms AUTHENTICATE may negotiate,
+	// keyed by name, registered via SASL
+	Mechanisms map[string]func() SASLMechanism
+	// Authenticator resolves an identity validated by AUTHENTICATE to
+	// the Mailstore scoped to it. If unset, a successful AUTHENTICATE
+	// leaves the session on Store.
+	Authenticator SASLAuthenticator
+	// LoginAuth validates the plaintext credentials carried by a LOGIN
+	// command. If unset, LOGIN is refused entirely - a Mailstore alone
+	// has no notion of a password to check.
+	LoginAuth LoginAuthenticator
+}
+
+// LoginAuthenticator validates the userId/password LOGIN sends in the
+// clear (or over TLS) and resolves them to the Mailstore scoped to that
+// user, mirroring what SASLAuthenticator does for AUTHENTICATE
+type LoginAuthenticator interface {
+	Authenticate(userId, password string) (Mailstore, error)
+}
+
+// Option configures a Server at construction time
+type Option func(*Config)
+
+// Store sets the Mailstore used to service IMAP requests
+func Store(m Mailstore) Option {
+	return func(c *Config) {
+		c.Store = m
+	}
+}
+
+// TLS enables STARTTLS, negotiated using cfg
+func TLS(cfg *tls.Config) Option {
+	return func(c *Config) {
+		c.TLSConfig = cfg
+	}
+}
+
+// AllowInsecureAuth permits LOGIN (and AUTHENTICATE) to run over a
+// cleartext connection. By default they are refused unless the
+// connection is TLS-protected.
+func AllowInsecureAuth() Option {
+	return func(c *Config) {
+		c.AllowInsecureAuth = true
+	}
+}
+
+// SASL registers a SASL mechanism that AUTHENTICATE may negotiate,
+// under the name reported by a mechanism built from factory
+func SASL(factory func() SASLMechanism) Option {
+	return func(c *Config) {
+		if c.Mechanisms == nil {
+			c.Mechanisms = make(map[string]func() SASLMechanism)
+		}
+		c.Mechanisms[factory().Name()] = factory
+	}
+}
+
+// Authenticate sets the SASLAuthenticator used to resolve a validated
+// AUTHENTICATE identity to its Mailstore
+func Authenticate(a SASLAuthenticator) Option {
+	return func(c *Config) {
+		c.Authenticator = a
+	}
+}
+
+// LoginAuthenticate sets the LoginAuthenticator used to validate LOGIN
+// credentials and resolve them to a Mailstore
+func LoginAuthenticate(a LoginAuthenticator) Option {
+	return func(c *Config) {
+		c.LoginAuth = a
+	}
+}
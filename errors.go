@@ -0,0 +1,10 @@
+package imapsrv
+
+// parseError signals a malformed client command. Lexing functions panic
+// with a parseError, which the parser recovers from and turns into a
+// returned error.
+type parseError string
+
+func (e parseError) Error() string {
+	return string(e)
+}
@@ -0,0 +1,478 @@
+package imapsrv
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// partialRange is a BODY[section]<start.length> partial fetch range
+type partialRange struct {
+	start, length int64
+}
+
+// bodySection identifies a BODY[section] argument - either the whole
+// message, a header subset, the text of a (possibly nested) part, or a
+// numbered MIME part's MIME header
+type bodySection struct {
+	spec     string   // the section text as the client sent it, e.g. "1.2.HEADER.FIELDS"
+	part     []int    // numeric part path, e.g. [1, 2]
+	fieldsOp string   // "", "HEADER", "HEADER.FIELDS", "HEADER.FIELDS.NOT", "TEXT" or "MIME"
+	fields   []string // field names for HEADER.FIELDS(.NOT)
+	partial  *partialRange
+}
+
+// fetchAttr is a single FETCH data item, e.g. FLAGS, UID or BODY[TEXT]
+type fetchAttr struct {
+	name    string
+	section *bodySection
+	peek    bool
+}
+
+// fetchCommand is the FETCH/UID FETCH command
+type fetchCommand struct {
+	tag    string
+	useUID bool
+	set    []SeqRange
+	attrs  []*fetchAttr
+}
+
+// MailstoreFlagSetter is implemented by Mailstores that support assigning
+// a message's flags, e.g. so FETCH can implicitly set \Seen on a
+// non-.PEEK BODY[...] fetch
+type MailstoreFlagSetter interface {
+	// SetFlags replaces the flags of the message identified by uid in mbox
+	SetFlags(mbox *Mailbox, uid int64, flags []string) error
+}
+
+// marksSeen reports whether any requested attribute is a non-.PEEK
+// BODY[...] section, which RFC 3501 requires to implicitly set \Seen
+func (c *fetchCommand) marksSeen() bool {
+	for _, a := range c.attrs {
+		if a.section != nil && !a.peek {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAttr reports whether name was requested as a plain (non-section)
+// FETCH attribute
+func (c *fetchCommand) hasAttr(name string) bool {
+	for _, a := range c.attrs {
+		if a.section == nil && a.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// messageHasFlag reports whether msg currently carries flag
+func messageHasFlag(msg Message, flag string) bool {
+	for _, f := range msg.Flags() {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// createFetch parses a FETCH or UID FETCH command
+func (p *parser) createFetch(tag string, useUID bool) (command, error) {
+	set, err := p.parseSequenceSet()
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs []*fetchAttr
+	p.lexer.skipSpace()
+	if p.lexer.current == leftParenthesis {
+		p.lexer.consume()
+		for {
+			p.lexer.skipSpace()
+			if p.lexer.current == rightParenthesis {
+				p.lexer.consume()
+				break
+			}
+			a, err := p.parseFetchAttr()
+			if err != nil {
+				return nil, err
+			}
+			attrs = append(attrs, a)
+		}
+	} else {
+		a, err := p.parseFetchAttr()
+		if err != nil {
+			return nil, err
+		}
+		attrs = expandFetchMacro(a)
+	}
+	p.lexer.next(asAny) // consume the trailing EOL
+
+	if useUID {
+		hasUID := false
+		for _, a := range attrs {
+			if a.name == "UID" {
+				hasUID = true
+			}
+		}
+		if !hasUID {
+			attrs = append(attrs, &fetchAttr{name: "UID"})
+		}
+	}
+
+	return &fetchCommand{tag: tag, useUID: useUID, set: set, attrs: attrs}, nil
+}
+
+// expandFetchMacro expands the ALL/FAST/FULL macros into their
+// constituent attributes
+func expandFetchMacro(a *fetchAttr) []*fetchAttr {
+	switch a.name {
+	case "ALL":
+		return []*fetchAttr{{name: "FLAGS"}, {name: "INTERNALDATE"}, {name: "RFC822.SIZE"}, {name: "ENVELOPE"}}
+	case "FAST":
+		return []*fetchAttr{{name: "FLAGS"}, {name: "INTERNALDATE"}, {name: "RFC822.SIZE"}}
+	case "FULL":
+		return []*fetchAttr{{name: "FLAGS"}, {name: "INTERNALDATE"}, {name: "RFC822.SIZE"}, {name: "ENVELOPE"}, {name: "BODY"}}
+	default:
+		return []*fetchAttr{a}
+	}
+}
+
+// parseFetchAttr parses a single FETCH data item
+func (p *parser) parseFetchAttr() (*fetchAttr, error) {
+	name := strings.ToUpper(p.readBareWord())
+	if name == "" {
+		return nil, parseError("Expected a FETCH attribute")
+	}
+
+	peek := false
+	base := name
+	if strings.HasSuffix(name, ".PEEK") {
+		peek = true
+		base = strings.TrimSuffix(name, ".PEEK")
+	}
+
+	if base != "BODY" || p.lexer.current != leftBracket {
+		return &fetchAttr{name: name}, nil
+	}
+
+	p.lexer.consume() // consume the '['
+	section, err := p.parseBodySection()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.lexer.current == lessThan {
+		p.lexer.consume()
+		start, err := strconv.ParseInt(p.readDigits(), 10, 64)
+		if err != nil {
+			return nil, parseError("Invalid partial fetch start")
+		}
+		if p.lexer.current != period {
+			return nil, parseError("Expected '.' in partial fetch range")
+		}
+		p.lexer.consume()
+		length, err := strconv.ParseInt(p.readDigits(), 10, 64)
+		if err != nil {
+			return nil, parseError("Invalid partial fetch length")
+		}
+		if p.lexer.current != greaterThan {
+			return nil, parseError("Expected '>' in partial fetch range")
+		}
+		p.lexer.consume()
+		section.partial = &partialRange{start: start, length: length}
+	}
+
+	return &fetchAttr{name: base, section: section, peek: peek}, nil
+}
+
+// parseBodySection parses a BODY[...] section spec - the leading '[' has
+// already been consumed
+func (p *parser) parseBodySection() (*bodySection, error) {
+	sec := &bodySection{}
+	var specBuf []byte
+
+	for p.lexer.current != rightBracket {
+		switch p.lexer.current {
+		case space:
+			p.lexer.consume()
+		case leftParenthesis:
+			p.lexer.consume()
+			for p.lexer.current != rightParenthesis {
+				p.lexer.skipSpace()
+				if p.lexer.current == rightParenthesis {
+					break
+				}
+				sec.fields = append(sec.fields, p.lexer.next(asAString).value)
+				p.lexer.skipSpace()
+			}
+			p.lexer.consume() // consume the ')'
+		default:
+			specBuf = append(specBuf, p.lexer.current)
+			p.lexer.consume()
+		}
+	}
+	p.lexer.consume() // consume the ']'
+
+	sec.spec = string(specBuf)
+	if sec.spec == "" {
+		return sec, nil
+	}
+
+	comps := strings.Split(sec.spec, ".")
+	i := 0
+	for i < len(comps) {
+		n, err := strconv.Atoi(comps[i])
+		if err != nil {
+			break
+		}
+		sec.part = append(sec.part, n)
+		i++
+	}
+	if i < len(comps) {
+		sec.fieldsOp = strings.ToUpper(strings.Join(comps[i:], "."))
+	}
+
+	return sec, nil
+}
+
+// readBareWord reads an unquoted run of characters up to the next space,
+// '[', '(' or ')', used for FETCH attribute names which the generic
+// lexer tokenizers don't stop at the right places for
+func (p *parser) readBareWord() string {
+	p.lexer.skipSpace()
+	var buf []byte
+	for p.lexer.current > space && p.lexer.current != leftBracket &&
+		p.lexer.current != leftParenthesis && p.lexer.current != rightParenthesis &&
+		p.lexer.current < 0x7f {
+		buf = append(buf, p.lexer.current)
+		p.lexer.consume()
+	}
+	return string(buf)
+}
+
+// readDigits reads a run of ASCII digits
+func (p *parser) readDigits() string {
+	var buf []byte
+	for p.lexer.current >= zero && p.lexer.current <= nine {
+		buf = append(buf, p.lexer.current)
+		p.lexer.consume()
+	}
+	return string(buf)
+}
+
+func (c *fetchCommand) execute(sess *session) *response {
+	if resp := sess.requireState(c.tag, selected); resp != nil {
+		return resp
+	}
+	if sess.mailbox == nil {
+		return bad(c.tag, "FETCH requires a selected mailbox")
+	}
+
+	msgs, err := sess.store().Fetch(sess.mailbox, c.set, c.useUID)
+	if err != nil {
+		return no(c.tag, err.Error())
+	}
+
+	completed := "FETCH completed"
+	if c.useUID {
+		completed = "UID FETCH completed"
+	}
+	resp := ok(c.tag, completed)
+	setter, canSetFlags := sess.store().(MailstoreFlagSetter)
+	marksSeen := c.marksSeen()
+
+	for _, msg := range msgs {
+		line, err := c.renderMessage(msg)
+		if err != nil {
+			return no(c.tag, err.Error())
+		}
+
+		if marksSeen && canSetFlags && !messageHasFlag(msg, "\\Seen") {
+			newFlags := append(append([]string{}, msg.Flags()...), "\\Seen")
+			if err := setter.SetFlags(sess.mailbox, msg.Uid(), newFlags); err != nil {
+				return no(c.tag, err.Error())
+			}
+			if !c.hasAttr("FLAGS") {
+				line += " FLAGS (" + strings.Join(newFlags, " ") + ")"
+			}
+		}
+
+		resp.extra(fmt.Sprintf("%d FETCH (%s)", msg.SequenceNumber(), line))
+	}
+
+	return resp
+}
+
+// renderMessage evaluates every requested attribute against msg and
+// joins them into a FETCH response's parenthesized data list
+func (c *fetchCommand) renderMessage(msg Message) (string, error) {
+	var parts []string
+	var top *mimePart
+
+	mime := func() (*mimePart, error) {
+		if top == nil {
+			var err error
+			top, err = loadMime(msg)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return top, nil
+	}
+
+	for _, attr := range c.attrs {
+		if attr.section != nil {
+			part, err := mime()
+			if err != nil {
+				return "", err
+			}
+			data, err := extractSection(part, attr.section)
+			if err != nil {
+				return "", err
+			}
+			annotation := ""
+			if attr.section.partial != nil {
+				data = slicePartial(data, attr.section.partial)
+				annotation = fmt.Sprintf("<%d>", attr.section.partial.start)
+			}
+			parts = append(parts, fmt.Sprintf("BODY[%s]%s {%d}\r\n%s", attr.section.spec, annotation, len(data), data))
+			continue
+		}
+
+		switch attr.name {
+		case "FLAGS":
+			parts = append(parts, "FLAGS ("+strings.Join(msg.Flags(), " ")+")")
+		case "UID":
+			parts = append(parts, fmt.Sprintf("UID %d", msg.Uid()))
+		case "INTERNALDATE":
+			parts = append(parts, "INTERNALDATE "+imapQuote(msg.InternalDate().Format(imapDateTimeLayout)))
+		case "RFC822.SIZE":
+			parts = append(parts, fmt.Sprintf("RFC822.SIZE %d", msg.Size()))
+		case "ENVELOPE":
+			part, err := mime()
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, "ENVELOPE "+buildEnvelope(part.header))
+		case "BODY":
+			part, err := mime()
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, "BODY "+buildBodyStructure(part))
+		case "BODYSTRUCTURE":
+			part, err := mime()
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, "BODYSTRUCTURE "+buildBodyStructure(part))
+		}
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// extractSection walks to the MIME part named by sec.part and returns
+// the requested subset of its bytes
+func extractSection(top *mimePart, sec *bodySection) ([]byte, error) {
+	part := top
+	for i, idx := range sec.part {
+		switch {
+		case idx >= 1 && idx <= len(part.children):
+			part = part.children[idx-1]
+		case idx == 1 && part.nested != nil:
+			part = part.nested
+		case idx == 1 && len(part.children) == 0 && part.nested == nil:
+			// A non-multipart message (and a message/rfc822 part once
+			// descended into) has no children of its own - RFC 3501
+			// §6.4.5 numbers its sole part "1". Any further nesting
+			// past this leaf is an error.
+			if i != len(sec.part)-1 {
+				return nil, fmt.Errorf("FETCH: no such body part")
+			}
+		default:
+			return nil, fmt.Errorf("FETCH: no such body part")
+		}
+	}
+
+	// HEADER/HEADER.FIELDS(.NOT)/TEXT, and a bare numeric fetch, name the
+	// embedded message itself when part is a message/rfc822 wrapper -
+	// only MIME (which names the wrapper's own MIME header) operates on
+	// part directly
+	target := part
+	if part.nested != nil && sec.fieldsOp != "MIME" {
+		target = part.nested
+	}
+
+	switch sec.fieldsOp {
+	case "HEADER":
+		return renderHeader(target.header, nil, false), nil
+	case "HEADER.FIELDS":
+		return renderHeader(target.header, sec.fields, false), nil
+	case "HEADER.FIELDS.NOT":
+		return renderHeader(target.header, sec.fields, true), nil
+	case "TEXT":
+		return target.body, nil
+	case "MIME":
+		return renderHeader(part.header, nil, false), nil
+	default:
+		if len(sec.part) > 0 && part.nested == nil {
+			return part.body, nil
+		}
+		var buf bytes.Buffer
+		buf.Write(renderHeader(target.header, nil, false))
+		buf.Write(target.body)
+		return buf.Bytes(), nil
+	}
+}
+
+// renderHeader reconstructs a header block as "Name: value\r\n" lines
+// followed by the blank line that terminates a header, optionally
+// filtered to (or excluding) the given field names. Field names are
+// emitted in sorted order: textproto.MIMEHeader is a map, so the
+// original message order isn't available to reconstruct, and sorting is
+// what keeps repeated FETCH of the same message byte-for-byte identical.
+func renderHeader(h map[string][]string, fields []string, exclude bool) []byte {
+	wanted := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		wanted[strings.ToUpper(f)] = true
+	}
+
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		if len(fields) > 0 {
+			_, isWanted := wanted[strings.ToUpper(name)]
+			if isWanted == exclude {
+				continue
+			}
+		}
+		for _, v := range h[name] {
+			fmt.Fprintf(&buf, "%s: %s\r\n", name, v)
+		}
+	}
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// slicePartial applies a BODY[section]<start.length> partial range to
+// already-extracted section data
+func slicePartial(data []byte, r *partialRange) []byte {
+	if r.start >= int64(len(data)) {
+		return nil
+	}
+	end := r.start + r.length
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return data[r.start:end]
+}
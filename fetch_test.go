@@ -0,0 +1,194 @@
+package imapsrv
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeMessage is a minimal Message for fetch tests
+type fakeMessage struct {
+	uid   int64
+	seq   int64
+	flags []string
+	raw   string
+}
+
+func (m *fakeMessage) Uid() int64                  { return m.uid }
+func (m *fakeMessage) SequenceNumber() int64       { return m.seq }
+func (m *fakeMessage) Flags() []string             { return m.flags }
+func (m *fakeMessage) InternalDate() time.Time     { return time.Unix(0, 0).UTC() }
+func (m *fakeMessage) Size() int64                 { return int64(len(m.raw)) }
+func (m *fakeMessage) Raw() (io.ReadSeeker, error) { return bytes.NewReader([]byte(m.raw)), nil }
+
+const fakeRawMessage = "From: a@example.com\r\nTo: b@example.com\r\nSubject: hi\r\n\r\nbody text\r\n"
+
+// flagSettingMailstore records SetFlags calls on top of TestMailstore's
+// dummy Fetch/Search/etc behaviour
+type flagSettingMailstore struct {
+	TestMailstore
+	msgs     []Message
+	setCalls int
+	setFlags []string
+}
+
+func (m *flagSettingMailstore) Fetch(mbox *Mailbox, set []SeqRange, useUID bool) ([]Message, error) {
+	return m.msgs, nil
+}
+
+func (m *flagSettingMailstore) SetFlags(mbox *Mailbox, uid int64, flags []string) error {
+	m.setCalls++
+	m.setFlags = flags
+	return nil
+}
+
+// TestFetchImplicitSeen tests that a non-.PEEK BODY[...] fetch marks the
+// message \Seen and reports the updated flags
+func TestFetchImplicitSeen(t *testing.T) {
+	store := &flagSettingMailstore{msgs: []Message{&fakeMessage{uid: 1, seq: 1, raw: fakeRawMessage}}}
+	s := NewServer(Store(store))
+	sess := createSession("1", s.config, s, nil, nil)
+	sess.st = selected
+	sess.mailbox = &Mailbox{Name: "inbox", Id: 1}
+
+	cmd := &fetchCommand{
+		tag: "A01",
+		set: []SeqRange{{From: 1, To: 1}},
+		attrs: []*fetchAttr{
+			{name: "BODY", section: &bodySection{spec: "TEXT", fieldsOp: "TEXT"}},
+		},
+	}
+	resp := cmd.execute(sess)
+
+	if resp.status != statusOk {
+		t.Fatalf("FETCH failed: %+v", resp)
+	}
+	if store.setCalls != 1 {
+		t.Fatalf("expected SetFlags to be called once, got %d", store.setCalls)
+	}
+	found := false
+	for _, f := range store.setFlags {
+		if f == "\\Seen" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected \\Seen among the set flags, got %v", store.setFlags)
+	}
+	if !strings.Contains(resp.untagged[0], "FLAGS (\\Seen)") {
+		t.Fatalf("expected FETCH response to report the new FLAGS, got %q", resp.untagged[0])
+	}
+}
+
+// TestFetchPeekDoesNotMarkSeen tests that a .PEEK BODY[...] fetch leaves
+// the message's flags untouched
+func TestFetchPeekDoesNotMarkSeen(t *testing.T) {
+	store := &flagSettingMailstore{msgs: []Message{&fakeMessage{uid: 1, seq: 1, raw: fakeRawMessage}}}
+	s := NewServer(Store(store))
+	sess := createSession("1", s.config, s, nil, nil)
+	sess.st = selected
+	sess.mailbox = &Mailbox{Name: "inbox", Id: 1}
+
+	cmd := &fetchCommand{
+		tag: "A01",
+		set: []SeqRange{{From: 1, To: 1}},
+		attrs: []*fetchAttr{
+			{name: "BODY", section: &bodySection{spec: "TEXT", fieldsOp: "TEXT"}, peek: true},
+		},
+	}
+	resp := cmd.execute(sess)
+
+	if resp.status != statusOk {
+		t.Fatalf("FETCH failed: %+v", resp)
+	}
+	if store.setCalls != 0 {
+		t.Fatalf("BODY.PEEK should not mark \\Seen, but SetFlags was called %d times", store.setCalls)
+	}
+}
+
+// TestExtractSectionBareOneOnNonMultipart tests that BODY[1] addresses a
+// non-multipart message's sole part, per RFC 3501 §6.4.5
+func TestExtractSectionBareOneOnNonMultipart(t *testing.T) {
+	top, err := parseMimeMessage([]byte(fakeRawMessage))
+	if err != nil {
+		t.Fatalf("parseMimeMessage failed: %v", err)
+	}
+
+	data, err := extractSection(top, &bodySection{spec: "1", part: []int{1}})
+	if err != nil {
+		t.Fatalf("BODY[1] failed: %v", err)
+	}
+	if !strings.Contains(string(data), "body text") {
+		t.Fatalf("BODY[1] did not return the message body: %q", data)
+	}
+
+	if _, err := extractSection(top, &bodySection{spec: "1.1", part: []int{1, 1}}); err == nil {
+		t.Fatal("BODY[1.1] should fail - a non-multipart message has no further nesting past part 1")
+	}
+	if _, err := extractSection(top, &bodySection{spec: "2", part: []int{2}}); err == nil {
+		t.Fatal("BODY[2] should fail - a non-multipart message only has part 1")
+	}
+}
+
+const fakeNestedRawMessage = "Content-Type: multipart/mixed; boundary=xyz\r\n\r\n" +
+	"--xyz\r\nContent-Type: text/plain\r\n\r\nouter body\r\n--xyz\r\n" +
+	"Content-Type: message/rfc822\r\n\r\n" +
+	"From: inner@example.com\r\nTo: outer@example.com\r\nSubject: fwd\r\n\r\ninner body\r\n" +
+	"--xyz--\r\n"
+
+// TestExtractSectionMessageRfc822 tests that .HEADER/.TEXT fetches on a
+// message/rfc822 part operate on the embedded message, not the
+// enclosing MIME wrapper
+func TestExtractSectionMessageRfc822(t *testing.T) {
+	top, err := parseMimeMessage([]byte(fakeNestedRawMessage))
+	if err != nil {
+		t.Fatalf("parseMimeMessage failed: %v", err)
+	}
+
+	header, err := extractSection(top, &bodySection{spec: "2.HEADER", part: []int{2}, fieldsOp: "HEADER"})
+	if err != nil {
+		t.Fatalf("BODY[2.HEADER] failed: %v", err)
+	}
+	if !strings.Contains(string(header), "Subject: fwd") {
+		t.Fatalf("BODY[2.HEADER] should return the embedded message's header, got %q", header)
+	}
+	if strings.Contains(string(header), "message/rfc822") {
+		t.Fatalf("BODY[2.HEADER] should not return the wrapper's Content-Type, got %q", header)
+	}
+
+	text, err := extractSection(top, &bodySection{spec: "2.TEXT", part: []int{2}, fieldsOp: "TEXT"})
+	if err != nil {
+		t.Fatalf("BODY[2.TEXT] failed: %v", err)
+	}
+	if strings.TrimSpace(string(text)) != "inner body" {
+		t.Fatalf("BODY[2.TEXT] should return only the embedded message's text, got %q", text)
+	}
+}
+
+// TestFetchPartialAnnotatesStart tests that a BODY[section]<start.length>
+// partial fetch echoes <start> in the response per RFC 3501 §7.4.2
+func TestFetchPartialAnnotatesStart(t *testing.T) {
+	store := &flagSettingMailstore{msgs: []Message{&fakeMessage{uid: 1, seq: 1, raw: fakeRawMessage}}}
+	s := NewServer(Store(store))
+	sess := createSession("1", s.config, s, nil, nil)
+	sess.st = selected
+	sess.mailbox = &Mailbox{Name: "inbox", Id: 1}
+
+	cmd := &fetchCommand{
+		tag: "A01",
+		set: []SeqRange{{From: 1, To: 1}},
+		attrs: []*fetchAttr{
+			{name: "BODY", section: &bodySection{spec: "TEXT", fieldsOp: "TEXT", partial: &partialRange{start: 5, length: 4}}, peek: true},
+		},
+	}
+	resp := cmd.execute(sess)
+
+	if resp.status != statusOk {
+		t.Fatalf("FETCH failed: %+v", resp)
+	}
+	if len(resp.untagged) != 1 || !strings.Contains(resp.untagged[0], "BODY[TEXT]<5>") {
+		t.Fatalf("expected the partial response to echo <5>, got %v", resp.untagged)
+	}
+}
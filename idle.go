@@ -0,0 +1,84 @@
+package imapsrv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// idleCommand is the IDLE command (RFC 2177)
+type idleCommand struct {
+	tag string
+}
+
+// createIdle parses an IDLE command
+func (p *parser) createIdle(tag string) (command, error) {
+	p.lexer.next(asAny) // consume the trailing EOL
+	return &idleCommand{tag: tag}, nil
+}
+
+func (c *idleCommand) execute(sess *session) *response {
+	if resp := sess.requireState(c.tag, selected); resp != nil {
+		return resp
+	}
+	if sess.mailbox == nil {
+		return bad(c.tag, "IDLE requires a selected mailbox")
+	}
+	if sess.conn == nil || sess.reader == nil {
+		return bad(c.tag, "IDLE requires a live connection")
+	}
+
+	events := make(chan MailboxEvent, 16)
+	cancel := notifierFor(sess.store()).SubscribeEvents(sess.mailbox, events)
+	defer cancel()
+
+	// Unblock the DONE read below if the server is shut down while we're
+	// idling
+	if sess.server != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-sess.server.ctx.Done():
+				sess.conn.Close()
+			case <-stop:
+			}
+		}()
+	}
+
+	fmt.Fprint(sess.conn, "+ idling\r\n")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			line, err := sess.reader.ReadString('\n')
+			if err != nil || strings.EqualFold(strings.TrimSpace(line), "DONE") {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case ev := <-events:
+			fmt.Fprintf(sess.conn, "* %s\r\n", formatMailboxEvent(ev))
+		case <-done:
+			return ok(c.tag, "IDLE terminated")
+		}
+	}
+}
+
+// formatMailboxEvent renders a MailboxEvent as the untagged line IDLE
+// reports it with
+func formatMailboxEvent(ev MailboxEvent) string {
+	switch ev.Type {
+	case EventExists:
+		return fmt.Sprintf("%d EXISTS", ev.SeqNum)
+	case EventExpunge:
+		return fmt.Sprintf("%d EXPUNGE", ev.SeqNum)
+	case EventFlagsChanged:
+		return fmt.Sprintf("%d FETCH (FLAGS (%s))", ev.SeqNum, strings.Join(ev.Flags, " "))
+	default:
+		return ""
+	}
+}
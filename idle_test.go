@@ -0,0 +1,62 @@
+package imapsrv
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestIdleRequiresSelectedMailbox tests that IDLE is rejected before a
+// mailbox is selected
+func TestIdleRequiresSelectedMailbox(t *testing.T) {
+	_, sess := setupTest()
+	cmd := &idleCommand{tag: "A01"}
+	resp := cmd.execute(sess)
+	if resp.status != statusBad {
+		t.Fatalf("expected IDLE to be rejected before SELECT, got %+v", resp)
+	}
+}
+
+// TestIdle tests that IDLE sends the continuation response and
+// terminates cleanly once the client sends DONE
+func TestIdle(t *testing.T) {
+	m := &TestMailstore{}
+	s := NewServer(Store(m))
+	sess := createSession("1", s.config, s, nil, nil)
+	sess.st = selected
+	sess.mailbox = &Mailbox{Name: "inbox", Id: 1}
+
+	serverConn, clientConn := net.Pipe()
+	sess.conn = serverConn
+	sess.reader = bufio.NewReader(serverConn)
+
+	done := make(chan *response, 1)
+	go func() {
+		cmd := &idleCommand{tag: "A01"}
+		done <- cmd.execute(sess)
+	}()
+
+	clientReader := bufio.NewReader(clientConn)
+	line, err := clientReader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read IDLE continuation: %v", err)
+	}
+	if strings.TrimSpace(line) != "+ idling" {
+		t.Fatalf("unexpected continuation response: %q", line)
+	}
+
+	if _, err := clientConn.Write([]byte("DONE\r\n")); err != nil {
+		t.Fatalf("failed to write DONE: %v", err)
+	}
+
+	select {
+	case resp := <-done:
+		if resp.tag != "A01" || resp.message != "IDLE terminated" {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("IDLE did not terminate after DONE")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"strconv"
 )
 
@@ -46,9 +47,13 @@ const (
 	leftParenthesis  = 0x28
 	rightParenthesis = 0x29
 	rightBracket     = 0x5d
+	leftBracket      = 0x5b
 	percent          = 0x25
 	asterisk         = 0x2a
 	backslash        = 0x5c
+	lessThan         = 0x3c
+	greaterThan      = 0x3e
+	period           = 0x2e
 )
 
 // char not present in the astring charset
@@ -86,12 +91,42 @@ var listMailboxExceptionsChar = []byte{
 	leftCurly,
 }
 
+// char not present in the sequence-set charset. Unlike astringExceptionsChar
+// this does not exclude '*', which sequence-sets use to mean the highest
+// numbered message, but it does stop at ')' so a sequence-set immediately
+// followed by a closing paren (e.g. "SEARCH (SEEN 1:5)") doesn't swallow it.
+var seqSetExceptionsChar = []byte{
+	space,
+	leftParenthesis,
+	rightParenthesis,
+	rightBracket,
+	percent,
+	backslash,
+	leftCurly,
+}
+
+// char not present in the flag charset, e.g. "\Seen" or "$Label" - like
+// the astring charset, except that neither a flag's leading backslash
+// nor '*' (as in "\*") stops the lexer. Also used for other bare words inside a parenthesized list
+// (e.g. STATUS's item names) where astring's backslash exclusion simply
+// never comes up.
+var flagExceptionsChar = []byte{
+	space,
+	leftParenthesis,
+	rightParenthesis,
+	rightBracket,
+	percent,
+	leftCurly,
+}
+
 // Flags that indicate how to lex unquoted strings
 const (
 	asAString = iota
 	asTag
 	asListMailbox
 	asAny
+	asSequenceSet
+	asFlag
 )
 
 type unquotedLexerFlag uint8
@@ -129,6 +164,10 @@ func (l *lexer) next(flag unquotedLexerFlag) *token {
 			return l.tagString()
 		case asListMailbox:
 			return l.listMailbox()
+		case asSequenceSet:
+			return l.sequenceSet()
+		case asFlag:
+			return l.flag()
 		default:
 			return l.astring()
 		}
@@ -165,13 +204,36 @@ func (l *lexer) qstring() *token {
 	return &token{string(buffer), stringTokenType}
 }
 
-// Parse a length tagged literal
+// Parse a length tagged literal, e.g. "{12}" or the RFC 7888
+// non-synchronizing form "{12+}"
 func (l *lexer) literal() *token {
 
+	length, _ := l.literalHeader()
+
+	buffer := make([]byte, 0, 64)
+
+	// Read the literal
+	for length > 0 {
+		buffer = append(buffer, l.current)
+		length -= 1
+		l.consume()
+	}
+
+	return &token{string(buffer), stringTokenType}
+}
+
+// literalHeader parses a literal's "{N}" or "{N+}" length prefix - the
+// leading '{' has already been consumed by the caller - leaving l.current
+// positioned at the first byte of the literal body. It returns the
+// literal's byte count and whether it was a non-synchronizing ({N+})
+// literal, which must not be preceded by a "+ Ready for literal data"
+// continuation response.
+func (l *lexer) literalHeader() (length int64, nonSync bool) {
+
 	lengthBuffer := make([]byte, 0, 8)
 
 	// Get the length of the literal
-	for l.current != rightCurly {
+	for l.current != rightCurly && l.current != plus {
 		if l.current < zero || l.current > nine {
 			err := parseError(fmt.Sprintf(
 				"Unexpected character %q in literal length", l.current))
@@ -182,25 +244,48 @@ func (l *lexer) literal() *token {
 		l.consume()
 	}
 
+	if l.current == plus {
+		nonSync = true
+		l.consume()
+	}
+
+	if l.current != rightCurly {
+		err := parseError(fmt.Sprintf(
+			"Unexpected character %q in literal length", l.current))
+		panic(err)
+	}
+
 	// Extract the literal length as an int
-	length, err := strconv.ParseInt(string(lengthBuffer), 10, 32)
+	length, err := strconv.ParseInt(string(lengthBuffer), 10, 63)
 	if err != nil {
 		panic(parseError(err.Error()))
 	}
 
-	// Consume the right curly and the newline that should follow
+	// Consume the right curly and the newline that should follow, then
+	// advance one more byte so l.current lands on the first byte of the
+	// literal body rather than the newline itself - consumeEol() only
+	// stops once it reaches the newline, it doesn't move past it.
 	l.consumeEol()
+	l.consume()
 
-	buffer := make([]byte, 0, 64)
+	return length, nonSync
+}
 
-	// Read the literal
-	for length > 0 {
-		buffer = append(buffer, l.current)
-		length -= 1
+// streamLiteral copies exactly n bytes of literal data directly from the
+// underlying reader into w, rather than buffering them into a token
+// value as literal() does. It is used for commands such as APPEND whose
+// literal bodies may be too large to hold in memory; the caller is
+// expected to have already obtained n (and whether to skip the
+// continuation response) from literalHeader().
+func (l *lexer) streamLiteral(n int64, w io.Writer) error {
+	for n > 0 {
+		if _, err := w.Write([]byte{l.current}); err != nil {
+			return err
+		}
+		n--
 		l.consume()
 	}
-
-	return &token{string(buffer), stringTokenType}
+	return nil
 }
 
 // An astring
@@ -218,6 +303,16 @@ func (l *lexer) listMailbox() *token {
 	return l.nonquoted("LIST-MAILBOX", listMailboxExceptionsChar)
 }
 
+// A sequence-set or uid-set, e.g. "1:5,7,9:*"
+func (l *lexer) sequenceSet() *token {
+	return l.nonquoted("SEQUENCE-SET", seqSetExceptionsChar)
+}
+
+// A message flag, e.g. "\Seen" or "$Label"
+func (l *lexer) flag() *token {
+	return l.nonquoted("FLAG", flagExceptionsChar)
+}
+
 // Any unquoted string
 func (l *lexer) any() *token {
 	return l.nonquoted("ANY", nil)
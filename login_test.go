@@ -0,0 +1,88 @@
+package imapsrv
+
+import (
+	"fmt"
+	"testing"
+)
+
+// recordingLoginAuthenticator is a LoginAuthenticator that accepts a
+// single userId/password pair and returns store for it
+type recordingLoginAuthenticator struct {
+	userId, password string
+	store            Mailstore
+	calls            int
+}
+
+func (a *recordingLoginAuthenticator) Authenticate(userId, password string) (Mailstore, error) {
+	a.calls++
+	if userId != a.userId || password != a.password {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+	return a.store, nil
+}
+
+// TestLoginWithoutAuthenticatorRefused tests that LOGIN is refused
+// outright when the server has no LoginAuthenticator configured, rather
+// than authenticating any credentials it's handed
+func TestLoginWithoutAuthenticatorRefused(t *testing.T) {
+	_, sess := setupTest()
+	sess.st = notAuthenticated
+	// TLS-protected, so the refusal can only come from the missing
+	// LoginAuthenticator
+	sess.tls = true
+
+	cmd := &login{tag: "A01", userId: "anyone", password: "anything"}
+	resp := cmd.execute(sess)
+	if resp.status != statusNo {
+		t.Fatalf("expected LOGIN to be refused without a LoginAuthenticator, got %+v", resp)
+	}
+	if sess.st != notAuthenticated {
+		t.Fatal("LOGIN should not have authenticated the session")
+	}
+}
+
+// TestLoginValidatesCredentials tests that LOGIN rejects the wrong
+// password and accepts the right one, only authenticating on success
+func TestLoginValidatesCredentials(t *testing.T) {
+	store := &TestMailstore{}
+	auth := &recordingLoginAuthenticator{userId: "fred", password: "s3cret", store: store}
+	s := NewServer(Store(&TestMailstore{}), LoginAuthenticate(auth), AllowInsecureAuth())
+	sess := createSession("1", s.config, s, nil, nil)
+
+	bad := &login{tag: "A01", userId: "fred", password: "wrong"}
+	if resp := bad.execute(sess); resp.status != statusNo {
+		t.Fatalf("expected wrong password to be rejected, got %+v", resp)
+	}
+	if sess.st != notAuthenticated {
+		t.Fatal("a rejected LOGIN must not authenticate the session")
+	}
+
+	good := &login{tag: "A02", userId: "fred", password: "s3cret"}
+	resp := good.execute(sess)
+	if resp.status != statusOk {
+		t.Fatalf("expected correct credentials to be accepted, got %+v", resp)
+	}
+	if sess.st != authenticated {
+		t.Fatal("LOGIN did not put the session into the authenticated state")
+	}
+	if sess.store() != store {
+		t.Fatal("LOGIN did not bind the Mailstore the LoginAuthenticator resolved")
+	}
+}
+
+// TestUnauthenticatedCommandsRejected tests that SELECT and CREATE both
+// refuse to run before LOGIN/AUTHENTICATE has succeeded
+func TestUnauthenticatedCommandsRejected(t *testing.T) {
+	_, sess := setupTest()
+	sess.st = notAuthenticated
+
+	sel := &selectCommand{tag: "A01", path: []string{"inbox"}}
+	if resp := sel.execute(sess); resp.status != statusBad {
+		t.Fatalf("expected SELECT to be rejected before LOGIN, got %+v", resp)
+	}
+
+	create := &createCommand{tag: "A02", path: []string{"inbox", "drafts"}}
+	if resp := create.execute(sess); resp.status != statusBad {
+		t.Fatalf("expected CREATE to be rejected before LOGIN, got %+v", resp)
+	}
+}
@@ -0,0 +1,232 @@
+package imapsrv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// createCommand is the CREATE command
+type createCommand struct {
+	tag  string
+	path []string
+}
+
+func (p *parser) createCreate(tag string) (command, error) {
+	mailbox := p.lexer.next(asAString).value
+	p.lexer.next(asAny) // consume the trailing EOL
+	return &createCommand{tag: tag, path: strings.Split(mailbox, "/")}, nil
+}
+
+func (c *createCommand) execute(sess *session) *response {
+	if resp := sess.requireState(c.tag, authenticated); resp != nil {
+		return resp
+	}
+	if err := sess.store().CreateMailbox(c.path); err != nil {
+		return no(c.tag, err.Error())
+	}
+	return ok(c.tag, "CREATE completed")
+}
+
+// deleteCommand is the DELETE command
+type deleteCommand struct {
+	tag  string
+	path []string
+}
+
+func (p *parser) createDelete(tag string) (command, error) {
+	mailbox := p.lexer.next(asAString).value
+	p.lexer.next(asAny) // consume the trailing EOL
+	return &deleteCommand{tag: tag, path: strings.Split(mailbox, "/")}, nil
+}
+
+func (c *deleteCommand) execute(sess *session) *response {
+	if resp := sess.requireState(c.tag, authenticated); resp != nil {
+		return resp
+	}
+	if err := sess.store().DeleteMailbox(c.path); err != nil {
+		return no(c.tag, err.Error())
+	}
+	return ok(c.tag, "DELETE completed")
+}
+
+// renameCommand is the RENAME command
+type renameCommand struct {
+	tag      string
+	from, to []string
+}
+
+func (p *parser) createRename(tag string) (command, error) {
+	from := p.lexer.next(asAString).value
+	to := p.lexer.next(asAString).value
+	p.lexer.next(asAny) // consume the trailing EOL
+	return &renameCommand{tag: tag, from: strings.Split(from, "/"), to: strings.Split(to, "/")}, nil
+}
+
+func (c *renameCommand) execute(sess *session) *response {
+	if resp := sess.requireState(c.tag, authenticated); resp != nil {
+		return resp
+	}
+	if err := sess.store().RenameMailbox(c.from, c.to); err != nil {
+		return no(c.tag, err.Error())
+	}
+	return ok(c.tag, "RENAME completed")
+}
+
+// subscribeCommand is the SUBSCRIBE command
+type subscribeCommand struct {
+	tag  string
+	path []string
+}
+
+func (p *parser) createSubscribe(tag string) (command, error) {
+	mailbox := p.lexer.next(asAString).value
+	p.lexer.next(asAny) // consume the trailing EOL
+	return &subscribeCommand{tag: tag, path: strings.Split(mailbox, "/")}, nil
+}
+
+func (c *subscribeCommand) execute(sess *session) *response {
+	if resp := sess.requireState(c.tag, authenticated); resp != nil {
+		return resp
+	}
+	if err := sess.store().Subscribe(c.path); err != nil {
+		return no(c.tag, err.Error())
+	}
+	return ok(c.tag, "SUBSCRIBE completed")
+}
+
+// unsubscribeCommand is the UNSUBSCRIBE command
+type unsubscribeCommand struct {
+	tag  string
+	path []string
+}
+
+func (p *parser) createUnsubscribe(tag string) (command, error) {
+	mailbox := p.lexer.next(asAString).value
+	p.lexer.next(asAny) // consume the trailing EOL
+	return &unsubscribeCommand{tag: tag, path: strings.Split(mailbox, "/")}, nil
+}
+
+func (c *unsubscribeCommand) execute(sess *session) *response {
+	if resp := sess.requireState(c.tag, authenticated); resp != nil {
+		return resp
+	}
+	if err := sess.store().Unsubscribe(c.path); err != nil {
+		return no(c.tag, err.Error())
+	}
+	return ok(c.tag, "UNSUBSCRIBE completed")
+}
+
+// listCommand is the LIST/LSUB command
+type listCommand struct {
+	tag            string
+	reference      []string
+	pattern        string
+	subscribedOnly bool
+}
+
+func (p *parser) createList(tag string, subscribedOnly bool) (command, error) {
+	reference := p.lexer.next(asAString).value
+	p.lexer.skipSpace()
+	pattern := p.lexer.next(asListMailbox).value
+	p.lexer.next(asAny) // consume the trailing EOL
+
+	var refPath []string
+	if reference != "" {
+		refPath = strings.Split(reference, "/")
+	}
+
+	return &listCommand{tag: tag, reference: refPath, pattern: pattern, subscribedOnly: subscribedOnly}, nil
+}
+
+func (c *listCommand) execute(sess *session) *response {
+	if resp := sess.requireState(c.tag, authenticated); resp != nil {
+		return resp
+	}
+
+	keyword, completed := "LIST", "LIST completed"
+	if c.subscribedOnly {
+		keyword, completed = "LSUB", "LSUB completed"
+	}
+	resp := ok(c.tag, completed)
+
+	if c.pattern == "" {
+		// An empty pattern requests only the hierarchy delimiter, per
+		// RFC 3501 6.3.8/6.3.9
+		resp.extra(fmt.Sprintf(`%s (\Noselect) "/" ""`, keyword))
+		return resp
+	}
+
+	mboxes, err := sess.store().ListMailboxes(c.reference, c.pattern, c.subscribedOnly)
+	if err != nil {
+		return no(c.tag, err.Error())
+	}
+
+	for _, mbox := range mboxes {
+		resp.extra(fmt.Sprintf(`%s (%s) "/" %s`,
+			keyword, strings.Join(mbox.Attributes, " "), imapQuote(strings.Join(mbox.Path, "/"))))
+	}
+
+	return resp
+}
+
+// statusCommand is the STATUS command
+type statusCommand struct {
+	tag   string
+	path  []string
+	items []StatusItem
+}
+
+func (p *parser) createStatus(tag string) (command, error) {
+	mailbox := p.lexer.next(asAString).value
+
+	p.lexer.skipSpace()
+	if p.lexer.current != leftParenthesis {
+		return nil, parseError("STATUS expected a parenthesized item list")
+	}
+	p.lexer.consume() // consume the '('
+
+	var items []StatusItem
+	for {
+		p.lexer.skipSpace()
+		if p.lexer.current == rightParenthesis {
+			p.lexer.consume()
+			break
+		}
+		item, err := statusItemFor(strings.ToUpper(p.lexer.next(asFlag).value))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	p.lexer.next(asAny) // consume the trailing EOL
+
+	return &statusCommand{tag: tag, path: strings.Split(mailbox, "/"), items: items}, nil
+}
+
+func (c *statusCommand) execute(sess *session) *response {
+	if resp := sess.requireState(c.tag, authenticated); resp != nil {
+		return resp
+	}
+
+	mbox, err := sess.store().GetMailbox(c.path)
+	if err != nil {
+		return no(c.tag, err.Error())
+	}
+	if mbox == nil {
+		return no(c.tag, "No such mailbox")
+	}
+
+	counts, err := sess.store().Status(mbox, c.items)
+	if err != nil {
+		return no(c.tag, err.Error())
+	}
+
+	parts := make([]string, len(c.items))
+	for i, item := range c.items {
+		parts[i] = fmt.Sprintf("%s %d", item, counts[item])
+	}
+
+	resp := ok(c.tag, "STATUS completed")
+	resp.extra(fmt.Sprintf("STATUS %s (%s)", imapQuote(strings.Join(mbox.Path, "/")), strings.Join(parts, " ")))
+	return resp
+}
@@ -0,0 +1,221 @@
+package imapsrv
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// recordingMailstore captures the arguments passed to the mailbox
+// management methods, on top of TestMailstore's dummy behaviour
+type recordingMailstore struct {
+	TestMailstore
+	createPath           []string
+	deletePath           []string
+	renameFrom, renameTo []string
+	subscribePath        []string
+	unsubscribePath      []string
+	listedReference      []string
+	listedPattern        string
+	listedSubscribedOnly bool
+	mailboxes            []*Mailbox
+	statusItems          []StatusItem
+	statusCounts         map[StatusItem]int64
+}
+
+func (m *recordingMailstore) CreateMailbox(path []string) error {
+	m.createPath = path
+	return nil
+}
+
+func (m *recordingMailstore) DeleteMailbox(path []string) error {
+	m.deletePath = path
+	return nil
+}
+
+func (m *recordingMailstore) RenameMailbox(from, to []string) error {
+	m.renameFrom, m.renameTo = from, to
+	return nil
+}
+
+func (m *recordingMailstore) Subscribe(path []string) error {
+	m.subscribePath = path
+	return nil
+}
+
+func (m *recordingMailstore) Unsubscribe(path []string) error {
+	m.unsubscribePath = path
+	return nil
+}
+
+func (m *recordingMailstore) ListMailboxes(reference []string, pattern string, subscribedOnly bool) ([]*Mailbox, error) {
+	m.listedReference, m.listedPattern, m.listedSubscribedOnly = reference, pattern, subscribedOnly
+	return m.mailboxes, nil
+}
+
+func (m *recordingMailstore) Status(mbox *Mailbox, items []StatusItem) (map[StatusItem]int64, error) {
+	m.statusItems = items
+	return m.statusCounts, nil
+}
+
+// parseCommand parses a single raw command line with the real parser
+func parseCommand(t *testing.T, raw string) command {
+	t.Helper()
+	p := createParser(bufio.NewReader(strings.NewReader(raw)))
+	cmd, err := p.next()
+	if err != nil {
+		t.Fatalf("unexpected parse error for %q: %v", raw, err)
+	}
+	return cmd
+}
+
+func TestCreateCommand(t *testing.T) {
+	store := &recordingMailstore{}
+	_, sess := setupTestWithStore(store)
+
+	resp := parseCommand(t, "A01 CREATE inbox/drafts\r\n").execute(sess)
+	if resp.status != statusOk {
+		t.Fatalf("CREATE failed: %+v", resp)
+	}
+	if got := strings.Join(store.createPath, "/"); got != "inbox/drafts" {
+		t.Fatalf("CreateMailbox got path %q", got)
+	}
+}
+
+func TestDeleteCommand(t *testing.T) {
+	store := &recordingMailstore{}
+	_, sess := setupTestWithStore(store)
+
+	resp := parseCommand(t, "A01 DELETE inbox/drafts\r\n").execute(sess)
+	if resp.status != statusOk {
+		t.Fatalf("DELETE failed: %+v", resp)
+	}
+	if got := strings.Join(store.deletePath, "/"); got != "inbox/drafts" {
+		t.Fatalf("DeleteMailbox got path %q", got)
+	}
+}
+
+func TestRenameCommand(t *testing.T) {
+	store := &recordingMailstore{}
+	_, sess := setupTestWithStore(store)
+
+	resp := parseCommand(t, "A01 RENAME inbox/drafts inbox/sent\r\n").execute(sess)
+	if resp.status != statusOk {
+		t.Fatalf("RENAME failed: %+v", resp)
+	}
+	if strings.Join(store.renameFrom, "/") != "inbox/drafts" || strings.Join(store.renameTo, "/") != "inbox/sent" {
+		t.Fatalf("RenameMailbox got from %v to %v", store.renameFrom, store.renameTo)
+	}
+}
+
+func TestSubscribeUnsubscribeCommands(t *testing.T) {
+	store := &recordingMailstore{}
+	_, sess := setupTestWithStore(store)
+
+	resp := parseCommand(t, "A01 SUBSCRIBE inbox\r\n").execute(sess)
+	if resp.status != statusOk {
+		t.Fatalf("SUBSCRIBE failed: %+v", resp)
+	}
+	if strings.Join(store.subscribePath, "/") != "inbox" {
+		t.Fatalf("Subscribe got path %v", store.subscribePath)
+	}
+
+	resp = parseCommand(t, "A02 UNSUBSCRIBE inbox\r\n").execute(sess)
+	if resp.status != statusOk {
+		t.Fatalf("UNSUBSCRIBE failed: %+v", resp)
+	}
+	if strings.Join(store.unsubscribePath, "/") != "inbox" {
+		t.Fatalf("Unsubscribe got path %v", store.unsubscribePath)
+	}
+}
+
+// TestListPattern tests that LIST forwards its reference and pattern to
+// the Mailstore and renders the returned mailboxes
+func TestListPattern(t *testing.T) {
+	store := &recordingMailstore{
+		mailboxes: []*Mailbox{
+			{Name: "drafts", Path: []string{"inbox", "drafts"}, Attributes: []string{`\HasNoChildren`}},
+		},
+	}
+	_, sess := setupTestWithStore(store)
+
+	resp := parseCommand(t, `A01 LIST inbox "%"`+"\r\n").execute(sess)
+	if resp.status != statusOk {
+		t.Fatalf("LIST failed: %+v", resp)
+	}
+	if strings.Join(store.listedReference, "/") != "inbox" || store.listedPattern != "%" {
+		t.Fatalf("ListMailboxes got reference %v pattern %q", store.listedReference, store.listedPattern)
+	}
+	if store.listedSubscribedOnly {
+		t.Fatalf("LIST should not restrict to subscribed mailboxes")
+	}
+	if len(resp.untagged) != 1 || !strings.Contains(resp.untagged[0], `LIST (\HasNoChildren) "/" "inbox/drafts"`) {
+		t.Fatalf("unexpected LIST response: %v", resp.untagged)
+	}
+}
+
+// TestListEmptyPattern tests that an empty pattern only returns the
+// hierarchy delimiter, per RFC 3501 6.3.8
+func TestListEmptyPattern(t *testing.T) {
+	store := &recordingMailstore{}
+	_, sess := setupTestWithStore(store)
+
+	resp := parseCommand(t, `A01 LIST inbox ""`+"\r\n").execute(sess)
+	if resp.status != statusOk {
+		t.Fatalf("LIST failed: %+v", resp)
+	}
+	if store.listedPattern != "" {
+		t.Fatalf("ListMailboxes should not have been called for an empty pattern")
+	}
+	if len(resp.untagged) != 1 || !strings.Contains(resp.untagged[0], `\Noselect`) {
+		t.Fatalf("unexpected LIST response: %v", resp.untagged)
+	}
+}
+
+// TestLsubSubscribedOnly tests that LSUB restricts ListMailboxes to
+// subscribed mailboxes
+func TestLsubSubscribedOnly(t *testing.T) {
+	store := &recordingMailstore{}
+	_, sess := setupTestWithStore(store)
+
+	resp := parseCommand(t, `A01 LSUB "" "*"`+"\r\n").execute(sess)
+	if resp.status != statusOk {
+		t.Fatalf("LSUB failed: %+v", resp)
+	}
+	if !store.listedSubscribedOnly {
+		t.Fatalf("LSUB should restrict ListMailboxes to subscribed mailboxes")
+	}
+}
+
+// TestStatusCommand tests that STATUS parses a multi-item list (which
+// regresses the asAny/')' bug that also affected APPEND's flag list) and
+// reports the Mailstore's counts
+func TestStatusCommand(t *testing.T) {
+	store := &recordingMailstore{
+		statusCounts: map[StatusItem]int64{
+			StatusMessages: 8,
+			StatusUnseen:   4,
+		},
+	}
+	_, sess := setupTestWithStore(store)
+
+	resp := parseCommand(t, "A01 STATUS inbox (MESSAGES UNSEEN)\r\n").execute(sess)
+	if resp.status != statusOk {
+		t.Fatalf("STATUS failed: %+v", resp)
+	}
+	if len(store.statusItems) != 2 || store.statusItems[0] != StatusMessages || store.statusItems[1] != StatusUnseen {
+		t.Fatalf("unexpected STATUS items parsed: %v", store.statusItems)
+	}
+	if len(resp.untagged) != 1 || !strings.Contains(resp.untagged[0], "MESSAGES 8") || !strings.Contains(resp.untagged[0], "UNSEEN 4") {
+		t.Fatalf("unexpected STATUS response: %v", resp.untagged)
+	}
+}
+
+// setupTestWithStore is like setupTest but backed by a caller-supplied
+// Mailstore
+func setupTestWithStore(store Mailstore) (*Server, *session) {
+	s := NewServer(Store(store))
+	sess := createSession("1", s.config, s, nil, nil)
+	sess.st = authenticated
+	return s, sess
+}
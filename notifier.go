@@ -0,0 +1,40 @@
+package imapsrv
+
+// MailboxEventType identifies the kind of change a Notifier publishes
+type MailboxEventType int
+
+const (
+	// EventExists signals that mbox's message count has increased
+	EventExists MailboxEventType = iota
+	// EventExpunge signals that the message at SeqNum has been removed
+	EventExpunge
+	// EventFlagsChanged signals that the message at SeqNum has new flags
+	EventFlagsChanged
+)
+
+// MailboxEvent is a single change to a mailbox, published by a Notifier
+type MailboxEvent struct {
+	Type   MailboxEventType
+	SeqNum int64
+	Flags  []string // populated for EventFlagsChanged
+}
+
+// Notifier is implemented by Mailstores that can push per-mailbox events
+// (new message arrived, flags changed, message expunged) to subscribers.
+// It is what powers IDLE; Mailstores that can't push events themselves
+// can instead be wrapped in a PollingNotifier.
+type Notifier interface {
+	// SubscribeEvents registers ch to receive events for mbox until the
+	// returned cancel function is called. ch should be buffered so a
+	// slow subscriber doesn't block the publisher.
+	SubscribeEvents(mbox *Mailbox, ch chan<- MailboxEvent) (cancel func())
+}
+
+// notifierFor returns store's own Notifier if it implements one, or
+// falls back to polling it
+func notifierFor(store Mailstore) Notifier {
+	if n, ok := store.(Notifier); ok {
+		return n
+	}
+	return NewPollingNotifier(store, defaultPollInterval)
+}
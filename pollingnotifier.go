@@ -0,0 +1,101 @@
+package imapsrv
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultPollInterval is how often a PollingNotifier re-checks a
+// mailbox's message counts
+const defaultPollInterval = 5 * time.Second
+
+// PollingNotifier adapts any Mailstore into a Notifier by periodically
+// diffing TotalMessages, for backends that can't push events of their
+// own. Its events are therefore coarser (and slower to arrive) than a
+// native Notifier's: it diffs only the aggregate message count, not
+// per-message identity or flags, so a PollingNotifier can
+// report that messages arrived (EventExists) or that the mailbox
+// shrank (EventExpunge, approximated as the highest-numbered messages
+// having been removed) but never EventFlagsChanged - a Mailstore that
+// needs to report flag changes over IDLE must implement Notifier
+// itself.
+type PollingNotifier struct {
+	store    Mailstore
+	interval time.Duration
+}
+
+// NewPollingNotifier creates a PollingNotifier that polls store every
+// interval
+func NewPollingNotifier(store Mailstore, interval time.Duration) *PollingNotifier {
+	return &PollingNotifier{
+		store:    store,
+		interval: interval,
+	}
+}
+
+// SubscribeEvents starts a goroutine polling mbox's message count,
+// publishing events to ch as it changes. Each subscription tracks its
+// own baseline count, so two sessions idling on the same mailbox at
+// once don't race over a shared one and silently steal each other's
+// events.
+func (n *PollingNotifier) SubscribeEvents(mbox *Mailbox, ch chan<- MailboxEvent) func() {
+	var total int64
+	if t, err := n.store.TotalMessages(mbox.Id); err == nil {
+		total = t
+	}
+
+	stop := make(chan struct{})
+	go n.poll(mbox, ch, stop, total)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// poll periodically diffs mbox's message count against this
+// subscription's own baseline (total) until stop is closed
+func (n *PollingNotifier) poll(mbox *Mailbox, ch chan<- MailboxEvent, stop chan struct{}, total int64) {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			newTotal, err := n.store.TotalMessages(mbox.Id)
+			if err != nil {
+				continue
+			}
+
+			for _, ev := range diffTotal(total, newTotal) {
+				select {
+				case ch <- ev:
+				default:
+					// subscriber isn't keeping up - drop the event rather
+					// than block the poller
+				}
+			}
+			total = newTotal
+		}
+	}
+}
+
+// diffTotal compares a mailbox's message count before and after a poll
+// tick and returns the events that explain the change: a single
+// EventExists reporting the new total if the count grew (mirroring a
+// real "* N EXISTS"), or one EventExpunge per removed message if it
+// shrank, highest sequence number first, as real EXPUNGE responses
+// must be ordered
+func diffTotal(oldTotal, newTotal int64) []MailboxEvent {
+	if newTotal > oldTotal {
+		return []MailboxEvent{{Type: EventExists, SeqNum: newTotal}}
+	}
+
+	events := make([]MailboxEvent, 0, oldTotal-newTotal)
+	for seq := oldTotal; seq > newTotal; seq-- {
+		events = append(events, MailboxEvent{Type: EventExpunge, SeqNum: seq})
+	}
+	return events
+}
@@ -0,0 +1,121 @@
+package imapsrv
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingMailstore is a TestMailstore whose TotalMessages can be bumped
+// from a test, with calls guarded by a mutex since the poller reads it
+// from its own goroutine
+type countingMailstore struct {
+	TestMailstore
+	mu    sync.Mutex
+	total int64
+}
+
+func (m *countingMailstore) TotalMessages(mbox int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total, nil
+}
+
+func (m *countingMailstore) set(total int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total = total
+}
+
+// TestDiffTotalGrowth tests that diffTotal reports a single EventExists
+// carrying the new total when the message count grows
+func TestDiffTotalGrowth(t *testing.T) {
+	events := diffTotal(3, 5)
+	if len(events) != 1 || events[0].Type != EventExists || events[0].SeqNum != 5 {
+		t.Fatalf("unexpected events for a growth from 3 to 5: %+v", events)
+	}
+}
+
+// TestDiffTotalShrink tests that diffTotal reports one EventExpunge per
+// removed message, highest sequence number first
+func TestDiffTotalShrink(t *testing.T) {
+	events := diffTotal(5, 2)
+	want := []MailboxEvent{
+		{Type: EventExpunge, SeqNum: 5},
+		{Type: EventExpunge, SeqNum: 4},
+		{Type: EventExpunge, SeqNum: 3},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("unexpected events for a shrink from 5 to 2: %+v", events)
+	}
+	for i, ev := range events {
+		if ev.Type != want[i].Type || ev.SeqNum != want[i].SeqNum {
+			t.Fatalf("event %d: got %+v, want %+v", i, ev, want[i])
+		}
+	}
+}
+
+// TestDiffTotalUnchanged tests that diffTotal reports nothing when the
+// count hasn't moved
+func TestDiffTotalUnchanged(t *testing.T) {
+	if events := diffTotal(4, 4); len(events) != 0 {
+		t.Fatalf("expected no events for an unchanged total, got %+v", events)
+	}
+}
+
+// TestPollingNotifierReportsGrowth tests that a subscriber sees an
+// EventExists once the polled mailbox's message count increases
+func TestPollingNotifierReportsGrowth(t *testing.T) {
+	store := &countingMailstore{total: 3}
+	n := NewPollingNotifier(store, 5*time.Millisecond)
+	mbox := &Mailbox{Id: 1}
+
+	ch := make(chan MailboxEvent, 16)
+	cancel := n.SubscribeEvents(mbox, ch)
+	defer cancel()
+
+	store.set(4)
+
+	select {
+	case ev := <-ch:
+		if ev.Type != EventExists || ev.SeqNum != 4 {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for EventExists")
+	}
+}
+
+// TestPollingNotifierPerSubscriptionBaseline tests that two independent
+// subscriptions on the same mailbox each see their own growth event,
+// regressing the shared-baseline race fixed previously
+func TestPollingNotifierPerSubscriptionBaseline(t *testing.T) {
+	store := &countingMailstore{total: 3}
+	n := NewPollingNotifier(store, 5*time.Millisecond)
+	mbox := &Mailbox{Id: 1}
+
+	chA := make(chan MailboxEvent, 16)
+	cancelA := n.SubscribeEvents(mbox, chA)
+	defer cancelA()
+
+	// Give subscriber A's poller a chance to tick against its baseline
+	// before B subscribes, then bump the count once
+	time.Sleep(10 * time.Millisecond)
+
+	chB := make(chan MailboxEvent, 16)
+	cancelB := n.SubscribeEvents(mbox, chB)
+	defer cancelB()
+
+	store.set(4)
+
+	for name, ch := range map[string]chan MailboxEvent{"A": chA, "B": chB} {
+		select {
+		case ev := <-ch:
+			if ev.Type != EventExists || ev.SeqNum != 4 {
+				t.Fatalf("subscriber %s: unexpected event: %+v", name, ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("subscriber %s: timed out waiting for EventExists", name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package imapsrv
+
+// responseStatus is the status condition of a tagged IMAP response
+type responseStatus int
+
+const (
+	statusOk responseStatus = iota
+	statusNo
+	statusBad
+)
+
+// response is the result of executing a command - it carries the tagged
+// completion response plus any untagged data that should be sent first
+type response struct {
+	tag      string
+	status   responseStatus
+	message  string
+	untagged []string
+}
+
+// ok creates a tagged OK response
+func ok(tag string, message string) *response {
+	return &response{tag: tag, status: statusOk, message: message}
+}
+
+// no creates a tagged NO response
+func no(tag string, message string) *response {
+	return &response{tag: tag, status: statusNo, message: message}
+}
+
+// bad creates a tagged BAD response
+func bad(tag string, message string) *response {
+	return &response{tag: tag, status: statusBad, message: message}
+}
+
+// extra appends an untagged line to the response and returns the response
+// so that calls can be chained
+func (r *response) extra(line string) *response {
+	r.untagged = append(r.untagged, line)
+	return r
+}
+
+// String returns the textual status keyword used on the wire
+func (s responseStatus) String() string {
+	switch s {
+	case statusOk:
+		return "OK"
+	case statusNo:
+		return "NO"
+	case statusBad:
+		return "BAD"
+	default:
+		return "BAD"
+	}
+}
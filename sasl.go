@@ -0,0 +1,79 @@
+package imapsrv
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SASLMechanism is a single SASL authentication mechanism, e.g. PLAIN,
+// LOGIN, CRAM-MD5, SCRAM-SHA-1/256 or XOAUTH2. A new instance is created
+// for each AUTHENTICATE attempt via the factory registered with SASL.
+type SASLMechanism interface {
+	// Name is the mechanism's IANA-registered name, as advertised in
+	// CAPABILITY's AUTH= entries
+	Name() string
+	// Next is called with the client's decoded response (on the very
+	// first call, the initial response if the client sent one, or nil
+	// otherwise) and returns
+	// the next server challenge to send, whether authentication is now
+	// complete, and any error that should abort it
+	Next(response []byte) (challenge []byte, done bool, err error)
+}
+
+// identityVerifier is implemented by SASLMechanisms that can report the
+// identity they authenticated once Next has signaled done
+type identityVerifier interface {
+	Identity() string
+}
+
+// SASLAuthenticator turns an identity validated by a SASLMechanism into
+// the Mailstore scoped to that user, replacing the single-user
+// assumption otherwise baked into Config.Store
+type SASLAuthenticator interface {
+	Authenticate(identity string) (Mailstore, error)
+}
+
+// PlainMechanism implements the SASL PLAIN mechanism (RFC 4616)
+type PlainMechanism struct {
+	validate func(authzid, authcid, password string) error
+	identity string
+}
+
+// NewPlainMechanism creates a PLAIN mechanism that defers credential
+// validation to validate
+func NewPlainMechanism(validate func(authzid, authcid, password string) error) func() SASLMechanism {
+	return func() SASLMechanism {
+		return &PlainMechanism{validate: validate}
+	}
+}
+
+func (m *PlainMechanism) Name() string {
+	return "PLAIN"
+}
+
+func (m *PlainMechanism) Next(response []byte) (challenge []byte, done bool, err error) {
+	if response == nil {
+		// No initial response was supplied - ask for one
+		return []byte{}, false, nil
+	}
+
+	parts := bytes.SplitN(response, []byte{0}, 3)
+	if len(parts) != 3 {
+		return nil, false, fmt.Errorf("malformed PLAIN response")
+	}
+	authzid, authcid, password := string(parts[0]), string(parts[1]), string(parts[2])
+
+	if err := m.validate(authzid, authcid, password); err != nil {
+		return nil, false, err
+	}
+
+	m.identity = authcid
+	if authzid != "" {
+		m.identity = authzid
+	}
+	return nil, true, nil
+}
+
+func (m *PlainMechanism) Identity() string {
+	return m.identity
+}
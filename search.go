@@ -0,0 +1,320 @@
+package imapsrv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchDateLayout is the RFC 3501 "date" format used by SEARCH's date
+// keys (BEFORE, ON, SINCE, ...), e.g. "1-Jan-2026"
+const searchDateLayout = "2-Jan-2006"
+
+// searchKey identifies a SEARCH criterion
+type searchKey int
+
+const (
+	searchAll searchKey = iota
+	searchAnd           // internal: every child criterion must match
+	searchAnswered
+	searchBcc
+	searchBefore
+	searchBody
+	searchCc
+	searchDeleted
+	searchDraft
+	searchFlagged
+	searchFrom
+	searchHeader
+	searchKeyword
+	searchLarger
+	searchNew
+	searchNot
+	searchOn
+	searchOr
+	searchRecent
+	searchSeen
+	searchSentBefore
+	searchSentOn
+	searchSentSince
+	searchSeqSet
+	searchSince
+	searchSmaller
+	searchSubject
+	searchText
+	searchTo
+	searchUid
+	searchUnanswered
+	searchUndeleted
+	searchUndraft
+	searchUnflagged
+	searchUnkeyword
+	searchUnseen
+)
+
+// SeqRange is an inclusive sequence number or UID range. A From or To of
+// 0 denotes "*", the highest numbered message in the mailbox.
+type SeqRange struct {
+	From, To uint32
+}
+
+// SearchCriteria is a parsed SEARCH/UID SEARCH key, forming a tree of
+// ANDed, ORed and negated criteria
+type SearchCriteria struct {
+	Key      searchKey
+	Str      string          // BCC/BODY/CC/FROM/KEYWORD/SUBJECT/TEXT/TO/UNKEYWORD argument
+	Field    string          // HEADER field name
+	Num      int64           // LARGER/SMALLER argument
+	Date     time.Time       // BEFORE/ON/SINCE/SENTBEFORE/SENTON/SENTSINCE argument
+	Set      []SeqRange      // sequence-set/UID argument
+	Left     *SearchCriteria // NOT operand, left OR operand
+	Right    *SearchCriteria // right OR operand
+	Children []*SearchCriteria
+}
+
+// searchCommand is the SEARCH/UID SEARCH command
+type searchCommand struct {
+	tag    string
+	useUID bool
+	crit   *SearchCriteria
+}
+
+// createSearch parses a SEARCH or UID SEARCH command
+func (p *parser) createSearch(tag string, useUID bool) (command, error) {
+	var children []*SearchCriteria
+
+	for {
+		p.lexer.skipSpace()
+		if p.lexer.current == cr {
+			break
+		}
+		crit, err := p.parseSearchKey()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, crit)
+	}
+	p.lexer.next(asAny) // consume the trailing EOL
+
+	if len(children) == 0 {
+		return nil, parseError("SEARCH requires at least one search key")
+	}
+
+	crit := children[0]
+	if len(children) > 1 {
+		crit = &SearchCriteria{Key: searchAnd, Children: children}
+	}
+
+	return &searchCommand{tag: tag, useUID: useUID, crit: crit}, nil
+}
+
+// parseSearchKey parses a single search key, recursing into parenthesized
+// groups and the NOT/OR operators
+func (p *parser) parseSearchKey() (*SearchCriteria, error) {
+	p.lexer.skipSpace()
+
+	if p.lexer.current == leftParenthesis {
+		p.lexer.consume()
+		var children []*SearchCriteria
+		for {
+			p.lexer.skipSpace()
+			if p.lexer.current == rightParenthesis {
+				p.lexer.consume()
+				break
+			}
+			crit, err := p.parseSearchKey()
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, crit)
+		}
+		return &SearchCriteria{Key: searchAnd, Children: children}, nil
+	}
+
+	if (p.lexer.current >= zero && p.lexer.current <= nine) || p.lexer.current == asterisk {
+		set, err := p.parseSequenceSet()
+		if err != nil {
+			return nil, err
+		}
+		return &SearchCriteria{Key: searchSeqSet, Set: set}, nil
+	}
+
+	word := strings.ToUpper(p.lexer.next(asAny).value)
+
+	switch word {
+	case "ALL":
+		return &SearchCriteria{Key: searchAll}, nil
+	case "ANSWERED":
+		return &SearchCriteria{Key: searchAnswered}, nil
+	case "DELETED":
+		return &SearchCriteria{Key: searchDeleted}, nil
+	case "DRAFT":
+		return &SearchCriteria{Key: searchDraft}, nil
+	case "FLAGGED":
+		return &SearchCriteria{Key: searchFlagged}, nil
+	case "NEW":
+		return &SearchCriteria{Key: searchNew}, nil
+	case "RECENT":
+		return &SearchCriteria{Key: searchRecent}, nil
+	case "SEEN":
+		return &SearchCriteria{Key: searchSeen}, nil
+	case "UNANSWERED":
+		return &SearchCriteria{Key: searchUnanswered}, nil
+	case "UNDELETED":
+		return &SearchCriteria{Key: searchUndeleted}, nil
+	case "UNDRAFT":
+		return &SearchCriteria{Key: searchUndraft}, nil
+	case "UNFLAGGED":
+		return &SearchCriteria{Key: searchUnflagged}, nil
+	case "UNSEEN":
+		return &SearchCriteria{Key: searchUnseen}, nil
+	case "BCC", "BODY", "CC", "FROM", "KEYWORD", "SUBJECT", "TEXT", "TO", "UNKEYWORD":
+		str := p.lexer.next(asAString).value
+		return &SearchCriteria{Key: searchKeyFor(word), Str: str}, nil
+	case "BEFORE", "ON", "SINCE", "SENTBEFORE", "SENTON", "SENTSINCE":
+		dateStr := p.lexer.next(asAString).value
+		date, err := time.Parse(searchDateLayout, dateStr)
+		if err != nil {
+			return nil, parseError(fmt.Sprintf("Invalid search date %q", dateStr))
+		}
+		return &SearchCriteria{Key: searchKeyFor(word), Date: date}, nil
+	case "HEADER":
+		field := p.lexer.next(asAString).value
+		str := p.lexer.next(asAString).value
+		return &SearchCriteria{Key: searchHeader, Field: field, Str: str}, nil
+	case "LARGER", "SMALLER":
+		numStr := p.lexer.next(asAny).value
+		num, err := strconv.ParseInt(numStr, 10, 64)
+		if err != nil {
+			return nil, parseError(fmt.Sprintf("Invalid %s argument %q", word, numStr))
+		}
+		return &SearchCriteria{Key: searchKeyFor(word), Num: num}, nil
+	case "NOT":
+		left, err := p.parseSearchKey()
+		if err != nil {
+			return nil, err
+		}
+		return &SearchCriteria{Key: searchNot, Left: left}, nil
+	case "OR":
+		left, err := p.parseSearchKey()
+		if err != nil {
+			return nil, err
+		}
+		right, err := p.parseSearchKey()
+		if err != nil {
+			return nil, err
+		}
+		return &SearchCriteria{Key: searchOr, Left: left, Right: right}, nil
+	case "UID":
+		set, err := p.parseSequenceSet()
+		if err != nil {
+			return nil, err
+		}
+		return &SearchCriteria{Key: searchUid, Set: set}, nil
+	default:
+		return nil, parseError(fmt.Sprintf("Unknown search key %q", word))
+	}
+}
+
+// searchKeyFor maps a search keyword to its searchKey constant
+func searchKeyFor(word string) searchKey {
+	switch word {
+	case "BCC":
+		return searchBcc
+	case "BODY":
+		return searchBody
+	case "CC":
+		return searchCc
+	case "FROM":
+		return searchFrom
+	case "KEYWORD":
+		return searchKeyword
+	case "SUBJECT":
+		return searchSubject
+	case "TEXT":
+		return searchText
+	case "TO":
+		return searchTo
+	case "UNKEYWORD":
+		return searchUnkeyword
+	case "BEFORE":
+		return searchBefore
+	case "ON":
+		return searchOn
+	case "SINCE":
+		return searchSince
+	case "SENTBEFORE":
+		return searchSentBefore
+	case "SENTON":
+		return searchSentOn
+	case "SENTSINCE":
+		return searchSentSince
+	case "LARGER":
+		return searchLarger
+	default: // "SMALLER"
+		return searchSmaller
+	}
+}
+
+// parseSequenceSet parses a sequence-set or uid-set, e.g. "1:5,7,9:*"
+func (p *parser) parseSequenceSet() ([]SeqRange, error) {
+	raw := p.lexer.next(asSequenceSet).value
+
+	var ranges []SeqRange
+	for _, part := range strings.Split(raw, ",") {
+		if idx := strings.IndexByte(part, ':'); idx >= 0 {
+			from, err := parseSeqNum(part[:idx])
+			if err != nil {
+				return nil, err
+			}
+			to, err := parseSeqNum(part[idx+1:])
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, SeqRange{From: from, To: to})
+		} else {
+			n, err := parseSeqNum(part)
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, SeqRange{From: n, To: n})
+		}
+	}
+	return ranges, nil
+}
+
+// parseSeqNum parses a single sequence number, where "*" is returned as 0
+func parseSeqNum(s string) (uint32, error) {
+	if s == "*" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, parseError(fmt.Sprintf("Invalid sequence number %q", s))
+	}
+	return uint32(n), nil
+}
+
+func (c *searchCommand) execute(sess *session) *response {
+	if resp := sess.requireState(c.tag, selected); resp != nil {
+		return resp
+	}
+	if sess.mailbox == nil {
+		return bad(c.tag, "SEARCH requires a selected mailbox")
+	}
+
+	ids, err := sess.store().Search(sess.mailbox, c.crit, c.useUID)
+	if err != nil {
+		return no(c.tag, err.Error())
+	}
+
+	line := "SEARCH"
+	for _, id := range ids {
+		line += fmt.Sprint(" ", id)
+	}
+
+	resp := ok(c.tag, "SEARCH completed")
+	resp.extra(line)
+	return resp
+}
@@ -0,0 +1,63 @@
+package imapsrv
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// TestParseSequenceSetBeforeClosingParen tests that a sequence-set
+// immediately followed by ')' parses correctly, rather than the ')'
+// being absorbed into the sequence-set token
+func TestParseSequenceSetBeforeClosingParen(t *testing.T) {
+	p := createParser(bufio.NewReader(strings.NewReader("A01 SEARCH (SEEN 1:5)\r\n")))
+	cmd, err := p.next()
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	search, ok := cmd.(*searchCommand)
+	if !ok {
+		t.Fatalf("expected *searchCommand, got %T", cmd)
+	}
+	if search.crit.Key != searchAnd || len(search.crit.Children) != 2 {
+		t.Fatalf("unexpected criteria tree: %+v", search.crit)
+	}
+	seqSet := search.crit.Children[1]
+	if seqSet.Key != searchSeqSet || len(seqSet.Set) != 1 ||
+		seqSet.Set[0] != (SeqRange{From: 1, To: 5}) {
+		t.Fatalf("unexpected sequence-set criterion: %+v", seqSet)
+	}
+}
+
+// TestInSeqSetResolvesStarOnce tests that "*" in a sequence-set range is
+// resolved to a fixed maximum, not re-resolved to whatever candidate is
+// being tested
+func TestInSeqSetResolvesStarOnce(t *testing.T) {
+	crit := &SearchCriteria{Key: searchSeqSet, Set: []SeqRange{{From: 5, To: 0}}}
+	resolveSeqSets(crit, 10, 0)
+
+	if inSeqSet(crit.Set, 2) {
+		t.Error(`"5:*" matched sequence number 2 - "*" was not resolved to a fixed bound`)
+	}
+	if !inSeqSet(crit.Set, 7) {
+		t.Error(`"5:*" should match sequence number 7`)
+	}
+	if !inSeqSet(crit.Set, 10) {
+		t.Error(`"5:*" should match the resolved maximum`)
+	}
+}
+
+// TestInSeqSetLoneStar tests that a lone "*" only matches the resolved
+// maximum, not every message
+func TestInSeqSetLoneStar(t *testing.T) {
+	crit := &SearchCriteria{Key: searchSeqSet, Set: []SeqRange{{From: 0, To: 0}}}
+	resolveSeqSets(crit, 3, 0)
+
+	if inSeqSet(crit.Set, 1) || inSeqSet(crit.Set, 2) {
+		t.Error(`lone "*" matched a message other than the maximum`)
+	}
+	if !inSeqSet(crit.Set, 3) {
+		t.Error(`lone "*" should match the maximum sequence number`)
+	}
+}
@@ -0,0 +1,221 @@
+package imapsrv
+
+import (
+	"strings"
+	"time"
+)
+
+// SearchableMessage is what SearchMessages needs from a message in order
+// to evaluate a SearchCriteria against it
+type SearchableMessage interface {
+	// Uid returns the message's UID
+	Uid() int64
+	// Flags returns the message's current flags
+	Flags() []string
+	// InternalDate returns the message's IMAP internal date
+	InternalDate() time.Time
+	// SentDate returns the date from the message's Date header
+	SentDate() time.Time
+	// Size returns the message's RFC 822 size in bytes
+	Size() int64
+	// Header returns the value of the named header, or "" if absent
+	Header(name string) string
+	// Contains reports whether s occurs in the message body or headers,
+	// for the BODY/TEXT search keys
+	Contains(s string) bool
+}
+
+// MessageIterator produces the messages of a mailbox, in sequence number
+// order, for SearchMessages to evaluate criteria against. It lets a
+// Mailstore that can't push predicates down to its storage layer satisfy
+// Mailstore.Search without loading every message into memory at once.
+type MessageIterator interface {
+	// Next returns the next message and its sequence number, or
+	// ok == false once the mailbox is exhausted
+	Next() (seq int64, msg SearchableMessage, ok bool)
+}
+
+// SearchMessages evaluates crit against every message produced by it,
+// returning the matching sequence numbers, or UIDs if useUID is set.
+// maxSeq and maxUID are the mailbox's highest sequence number and UID,
+// used to resolve "*" in sequence-set and UID-set search keys.
+func SearchMessages(it MessageIterator, crit *SearchCriteria, useUID bool, maxSeq, maxUID uint32) ([]int64, error) {
+	resolveSeqSets(crit, maxSeq, maxUID)
+
+	var results []int64
+
+	for {
+		seq, msg, ok := it.Next()
+		if !ok {
+			break
+		}
+		if matchesCriteria(crit, seq, msg) {
+			if useUID {
+				results = append(results, msg.Uid())
+			} else {
+				results = append(results, seq)
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// matchesCriteria reports whether msg satisfies crit
+func matchesCriteria(crit *SearchCriteria, seq int64, msg SearchableMessage) bool {
+	if crit == nil {
+		return true
+	}
+
+	switch crit.Key {
+	case searchAll:
+		return true
+	case searchAnd:
+		for _, child := range crit.Children {
+			if !matchesCriteria(child, seq, msg) {
+				return false
+			}
+		}
+		return true
+	case searchOr:
+		return matchesCriteria(crit.Left, seq, msg) || matchesCriteria(crit.Right, seq, msg)
+	case searchNot:
+		return !matchesCriteria(crit.Left, seq, msg)
+	case searchSeqSet:
+		return inSeqSet(crit.Set, uint32(seq))
+	case searchUid:
+		return inSeqSet(crit.Set, uint32(msg.Uid()))
+	case searchAnswered:
+		return hasFlag(msg, "\\Answered")
+	case searchUnanswered:
+		return !hasFlag(msg, "\\Answered")
+	case searchDeleted:
+		return hasFlag(msg, "\\Deleted")
+	case searchUndeleted:
+		return !hasFlag(msg, "\\Deleted")
+	case searchDraft:
+		return hasFlag(msg, "\\Draft")
+	case searchUndraft:
+		return !hasFlag(msg, "\\Draft")
+	case searchFlagged:
+		return hasFlag(msg, "\\Flagged")
+	case searchUnflagged:
+		return !hasFlag(msg, "\\Flagged")
+	case searchRecent:
+		return hasFlag(msg, "\\Recent")
+	case searchNew:
+		return hasFlag(msg, "\\Recent") && !hasFlag(msg, "\\Seen")
+	case searchSeen:
+		return hasFlag(msg, "\\Seen")
+	case searchUnseen:
+		return !hasFlag(msg, "\\Seen")
+	case searchKeyword:
+		return hasFlag(msg, crit.Str)
+	case searchUnkeyword:
+		return !hasFlag(msg, crit.Str)
+	case searchBefore:
+		return truncateDay(msg.InternalDate()).Before(crit.Date)
+	case searchOn:
+		return truncateDay(msg.InternalDate()).Equal(crit.Date)
+	case searchSince:
+		return !truncateDay(msg.InternalDate()).Before(crit.Date)
+	case searchSentBefore:
+		return truncateDay(msg.SentDate()).Before(crit.Date)
+	case searchSentOn:
+		return truncateDay(msg.SentDate()).Equal(crit.Date)
+	case searchSentSince:
+		return !truncateDay(msg.SentDate()).Before(crit.Date)
+	case searchLarger:
+		return msg.Size() > crit.Num
+	case searchSmaller:
+		return msg.Size() < crit.Num
+	case searchFrom:
+		return containsFold(msg.Header("From"), crit.Str)
+	case searchTo:
+		return containsFold(msg.Header("To"), crit.Str)
+	case searchCc:
+		return containsFold(msg.Header("Cc"), crit.Str)
+	case searchBcc:
+		return containsFold(msg.Header("Bcc"), crit.Str)
+	case searchSubject:
+		return containsFold(msg.Header("Subject"), crit.Str)
+	case searchHeader:
+		return containsFold(msg.Header(crit.Field), crit.Str)
+	case searchBody, searchText:
+		return msg.Contains(crit.Str)
+	default:
+		return false
+	}
+}
+
+// inSeqSet reports whether n falls within any of the given ranges.
+// Ranges must already have had their "*" bounds resolved to a concrete
+// value by resolveSeqSets - "*" means the highest numbered message in
+// the mailbox, not a bound that tracks whatever n happens to be.
+func inSeqSet(ranges []SeqRange, n uint32) bool {
+	for _, r := range ranges {
+		from, to := r.From, r.To
+		if from > to {
+			from, to = to, from
+		}
+		if n >= from && n <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSeqSets rewrites crit's sequence-set and UID-set "*" bounds
+// (a SeqRange.From/To of 0) to maxSeq/maxUID respectively, so inSeqSet
+// can test each range against a fixed value instead of re-resolving "*"
+// differently for every candidate message
+func resolveSeqSets(crit *SearchCriteria, maxSeq, maxUID uint32) {
+	if crit == nil {
+		return
+	}
+
+	switch crit.Key {
+	case searchSeqSet:
+		resolveRanges(crit.Set, maxSeq)
+	case searchUid:
+		resolveRanges(crit.Set, maxUID)
+	case searchAnd:
+		for _, child := range crit.Children {
+			resolveSeqSets(child, maxSeq, maxUID)
+		}
+	case searchOr:
+		resolveSeqSets(crit.Left, maxSeq, maxUID)
+		resolveSeqSets(crit.Right, maxSeq, maxUID)
+	case searchNot:
+		resolveSeqSets(crit.Left, maxSeq, maxUID)
+	}
+}
+
+// resolveRanges replaces every "*" (0) bound in ranges with max
+func resolveRanges(ranges []SeqRange, max uint32) {
+	for i := range ranges {
+		if ranges[i].From == 0 {
+			ranges[i].From = max
+		}
+		if ranges[i].To == 0 {
+			ranges[i].To = max
+		}
+	}
+}
+
+func hasFlag(msg SearchableMessage, flag string) bool {
+	for _, f := range msg.Flags() {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(haystack, needle string) bool {
+	return strings.Contains(strings.ToLower(haystack), strings.ToLower(needle))
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
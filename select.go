@@ -0,0 +1,56 @@
+package imapsrv
+
+import "strings"
+
+// selectCommand is the SELECT/EXAMINE command
+type selectCommand struct {
+	tag      string
+	path     []string
+	readOnly bool // true for EXAMINE, which selects the mailbox read-only
+}
+
+// createSelect parses a SELECT or EXAMINE command
+func (p *parser) createSelect(tag string, readOnly bool) (command, error) {
+	mailbox := p.lexer.next(asAString).value
+	p.lexer.next(asAny) // consume the trailing EOL
+	return &selectCommand{tag: tag, path: strings.Split(mailbox, "/"), readOnly: readOnly}, nil
+}
+
+func (c *selectCommand) execute(sess *session) *response {
+	if resp := sess.requireState(c.tag, authenticated); resp != nil {
+		return resp
+	}
+
+	keyword := "SELECT"
+	if c.readOnly {
+		keyword = "EXAMINE"
+	}
+
+	// A SELECT/EXAMINE always deselects any previously selected mailbox,
+	// even if this one fails to select
+	sess.mailbox = nil
+	sess.st = authenticated
+
+	found, err := sess.selectMailbox(strings.Join(c.path, "/"))
+	if err != nil {
+		return no(c.tag, err.Error())
+	}
+	if !found {
+		return no(c.tag, "No such mailbox")
+	}
+
+	sess.st = selected
+
+	resp := ok(c.tag, keyword+" completed")
+	resp.extra(`FLAGS (\Answered \Flagged \Deleted \Seen \Draft)`)
+	if err := sess.addMailboxInfo(resp); err != nil {
+		return no(c.tag, err.Error())
+	}
+
+	if c.readOnly {
+		resp.message = "[READ-ONLY] " + keyword + " completed"
+	} else {
+		resp.message = "[READ-WRITE] " + keyword + " completed"
+	}
+	return resp
+}
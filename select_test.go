@@ -0,0 +1,56 @@
+package imapsrv
+
+import "testing"
+
+// TestSelectCommand tests that SELECT moves the session into the
+// selected state and reports the mailbox's status
+func TestSelectCommand(t *testing.T) {
+	_, sess := setupTest()
+	cmd := &selectCommand{tag: "A01", path: []string{"inbox"}}
+	resp := cmd.execute(sess)
+
+	if resp.tag != "A01" || resp.message != "[READ-WRITE] SELECT completed" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if sess.st != selected {
+		t.Fatal("SELECT did not put the session into the selected state")
+	}
+	if sess.mailbox == nil {
+		t.Fatal("SELECT did not record the selected mailbox")
+	}
+}
+
+// TestExamineCommandReadOnly tests that EXAMINE selects the mailbox
+// read-only
+func TestExamineCommandReadOnly(t *testing.T) {
+	_, sess := setupTest()
+	cmd := &selectCommand{tag: "A01", path: []string{"inbox"}, readOnly: true}
+	resp := cmd.execute(sess)
+
+	if resp.message != "[READ-ONLY] EXAMINE completed" {
+		t.Fatalf("unexpected response message: %q", resp.message)
+	}
+	if sess.st != selected {
+		t.Fatal("EXAMINE did not put the session into the selected state")
+	}
+}
+
+// TestSelectUnlocksSearch tests that SEARCH is rejected before a mailbox
+// is selected, and permitted once SELECT has run
+func TestSelectUnlocksSearch(t *testing.T) {
+	_, sess := setupTest()
+
+	search := &searchCommand{tag: "A01", crit: &SearchCriteria{Key: searchAll}}
+	if resp := search.execute(sess); resp.status != statusBad {
+		t.Fatalf("expected SEARCH to be rejected before SELECT, got %+v", resp)
+	}
+
+	sel := &selectCommand{tag: "A02", path: []string{"inbox"}}
+	if resp := sel.execute(sess); resp.status != statusOk {
+		t.Fatalf("SELECT failed: %+v", resp)
+	}
+
+	if resp := search.execute(sess); resp.status != statusOk {
+		t.Fatalf("expected SEARCH to succeed after SELECT, got %+v", resp)
+	}
+}
@@ -0,0 +1,86 @@
+package imapsrv
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"sync/atomic"
+)
+
+// Server is an IMAP server
+type Server struct {
+	config    *Config
+	listeners []net.Listener
+	nextId    int64 // accessed atomically - Listen and ImplicitTLS each run their own serve goroutine
+
+	// ctx is canceled on Shutdown, unblocking any session parked in IDLE
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewServer creates a Server configured with the given Options
+func NewServer(options ...Option) *Server {
+	config := &Config{}
+
+	for _, opt := range options {
+		opt(config)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{config: config, ctx: ctx, cancel: cancel}
+}
+
+// Shutdown stops accepting new connections and unblocks any session
+// currently parked in IDLE
+func (s *Server) Shutdown() {
+	s.cancel()
+	for _, l := range s.listeners {
+		l.Close()
+	}
+}
+
+// Listen starts listening for plaintext IMAP connections on the given
+// address. Clients negotiate encryption themselves via STARTTLS.
+func (s *Server) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.listeners = append(s.listeners, listener)
+	go s.serve(listener, false)
+	return nil
+}
+
+// ImplicitTLS starts listening for IMAP connections that are TLS-protected
+// from the moment they're accepted, as is conventional on port 993,
+// rather than negotiating encryption via STARTTLS.
+func (s *Server) ImplicitTLS(addr string, cfg *tls.Config) error {
+	listener, err := tls.Listen("tcp", addr, cfg)
+	if err != nil {
+		return err
+	}
+
+	s.listeners = append(s.listeners, listener)
+	go s.serve(listener, true)
+	return nil
+}
+
+// serve accepts connections on the given listener until it is closed
+func (s *Server) serve(listener net.Listener, tlsAccepted bool) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Print("IMAP accept error: ", err)
+			return
+		}
+
+		id := atomic.AddInt64(&s.nextId, 1)
+		sess := createSession(fmt.Sprint(id), s.config, s, listener, conn)
+		sess.tls = tlsAccepted
+		go sess.serve(bufio.NewReader(conn), conn)
+	}
+}
@@ -1,9 +1,13 @@
-
-package imap
+package imapsrv
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"strings"
+	"time"
 )
 
 // IMAP session states
@@ -15,61 +19,193 @@ const (
 	selected
 )
 
-// A service that is needed to read mail messages
+// Mailstore is a service that is needed to read mail messages
 type Mailstore interface {
 	// Get IMAP mailbox information
 	// Returns nil if the mailbox does not exist
-	GetMailbox(name string) (*Mailbox, error)
+	GetMailbox(path []string) (*Mailbox, error)
 	// Get the sequence number of the first unseen message
 	FirstUnseen(mbox int64) (int64, error)
 	// Get the total number of messages in an IMAP mailbox
 	TotalMessages(mbox int64) (int64, error)
 	// Get the total number of unread messages in an IMAP mailbox
 	RecentMessages(mbox int64) (int64, error)
-	// Get the total number of unread messages in an IMAP mailbox
+	// Get the next UID that will be assigned in an IMAP mailbox
 	NextUid(mbox int64) (int64, error)
+	// Search evaluates crit against mbox's messages, returning matching
+	// sequence numbers, or UIDs if useUID is set
+	Search(mbox *Mailbox, crit *SearchCriteria, useUID bool) ([]int64, error)
+	// Fetch returns the messages of mbox named by set, which is
+	// interpreted as a set of UIDs if useUID is set, or sequence
+	// numbers otherwise
+	Fetch(mbox *Mailbox, set []SeqRange, useUID bool) ([]Message, error)
+	// CreateMailbox creates a new mailbox at path
+	CreateMailbox(path []string) error
+	// DeleteMailbox removes the mailbox at path
+	DeleteMailbox(path []string) error
+	// RenameMailbox moves the mailbox at from to to, along with its
+	// children
+	RenameMailbox(from, to []string) error
+	// Subscribe marks the mailbox at path as subscribed
+	Subscribe(path []string) error
+	// Unsubscribe marks the mailbox at path as no longer subscribed
+	Unsubscribe(path []string) error
+	// ListMailboxes returns the mailboxes rooted under reference whose
+	// name matches pattern ('%' matches any run of characters other
+	// than the hierarchy delimiter, '*' matches any run of characters
+	// including it), restricted to subscribed mailboxes if
+	// subscribedOnly is set
+	ListMailboxes(reference []string, pattern string, subscribedOnly bool) ([]*Mailbox, error)
+	// Status reports the requested status items for mbox, without
+	// making it the selected mailbox
+	Status(mbox *Mailbox, items []StatusItem) (map[StatusItem]int64, error)
+}
+
+// Message is a single stored message, addressable by FETCH/UID FETCH
+type Message interface {
+	// Uid returns the message's UID
+	Uid() int64
+	// SequenceNumber returns the message's sequence number in its mailbox
+	SequenceNumber() int64
+	// Flags returns the message's current flags
+	Flags() []string
+	// InternalDate returns the message's IMAP internal date
+	InternalDate() time.Time
+	// Size returns the message's RFC 822 size in bytes
+	Size() int64
+	// Raw returns a seekable reader over the message's raw RFC 822 bytes
+	Raw() (io.ReadSeeker, error)
 }
 
 // An IMAP mailbox
 type Mailbox struct {
-	Name string // The name of the mailbox
-	Id   int64  // The id of the mailbox
+	Name       string   // The name of the mailbox
+	Path       []string // The full hierarchical path of the mailbox
+	Id         int64    // The id of the mailbox
+	Attributes []string // LIST/LSUB mailbox name attributes, e.g. "\HasChildren", "\Noselect"
 }
 
 // An IMAP session
 type session struct {
 	// The client id
-	id int
+	id string
 	// The state of the session
 	st state
 	// The currently selected mailbox (if st == selected)
 	mailbox *Mailbox
 	// IMAP configuration
 	config *Config
+	// The server that accepted this session
+	server *Server
+	// The listener the session was accepted on
+	listener net.Listener
+	// The underlying network connection
+	conn net.Conn
+	// The buffered reader commands are parsed from - retained so that
+	// commands needing to read raw client data mid-command (e.g. IDLE's
+	// DONE) share the same buffer rather than losing bytes to a second one
+	reader *bufio.Reader
+	// Whether conn is TLS-protected, either negotiated via STARTTLS or
+	// because the session was accepted on an implicit-TLS listener
+	tls bool
+	// Set by STARTTLS once it has upgraded conn, so serve can rebuild its
+	// reader and parser around the encrypted stream
+	pendingReader *bufio.Reader
+	// The Mailstore scoped to the identity AUTHENTICATE or LOGIN validated, if any.
+	// Overrides config.Store's single-user assumption.
+	authStore Mailstore
+}
+
+// store returns the Mailstore this session should use: the one
+// AUTHENTICATE or LOGIN resolved for its authenticated identity, or
+// config.Store if the session hasn't authenticated yet
+func (s *session) store() Mailstore {
+	if s.authStore != nil {
+		return s.authStore
+	}
+	return s.config.Store
+}
+
+// requireState returns a BAD response if the session hasn't yet reached
+// min (e.g. a FETCH before LOGIN, or a SELECT before authentication), or
+// nil if the command may proceed
+func (s *session) requireState(tag string, min state) *response {
+	if s.st < min {
+		return bad(tag, "Command not valid in this state")
+	}
+	return nil
 }
 
 // Create a new IMAP session
-func createSession(id int, config *Config) *session {
+func createSession(id string, config *Config, server *Server, listener net.Listener, conn net.Conn) *session {
 	return &session{
-		id:     id,
-		st:     notAuthenticated,
-		config: config}
+		id:       id,
+		st:       notAuthenticated,
+		config:   config,
+		server:   server,
+		listener: listener,
+		conn:     conn,
+	}
 }
 
 // Log a message with session information
 func (s *session) log(info ...interface{}) {
-	preamble := fmt.Sprintf("IMAP (%d) ", s.id)
+	preamble := fmt.Sprintf("IMAP (%s) ", s.id)
 	message := []interface{}{preamble}
 	message = append(message, info...)
 	log.Print(message...)
 }
 
+// serve reads and executes commands from the client until the connection
+// is closed
+func (s *session) serve(in *bufio.Reader, out net.Conn) {
+	defer func() {
+		s.conn.Close()
+	}()
+
+	s.reader = in
+	p := createParser(in)
+
+	for {
+		cmd, err := p.next()
+		if err != nil {
+			s.log("parse error: ", err)
+			return
+		}
+
+		resp := cmd.execute(s)
+		if resp != nil {
+			writeResponse(s.conn, resp)
+		}
+
+		if _, isLogout := cmd.(*logout); isLogout {
+			return
+		}
+
+		// STARTTLS (or a future command like it) swapped the underlying
+		// connection - rebuild the parser around the encrypted stream
+		if s.pendingReader != nil {
+			s.reader = s.pendingReader
+			p = createParser(s.pendingReader)
+			s.pendingReader = nil
+		}
+	}
+}
+
+// writeResponse writes a response to the client connection
+func writeResponse(out net.Conn, resp *response) {
+	for _, line := range resp.untagged {
+		fmt.Fprintf(out, "* %s\r\n", line)
+	}
+	fmt.Fprintf(out, "%s %s %s\r\n", resp.tag, resp.status, resp.message)
+}
+
 // Select a mailbox - returns true if the mailbox exists
 func (s *session) selectMailbox(name string) (bool, error) {
-	mailstore := s.config.Store
+	mailstore := s.store()
 
 	// Lookup the mailbox
-	mbox, err := mailstore.GetMailbox(name)
+	mbox, err := mailstore.GetMailbox(strings.Split(name, "/"))
 
 	if err != nil {
 		return false, err
@@ -86,7 +222,7 @@ func (s *session) selectMailbox(name string) (bool, error) {
 
 // Add mailbox information to the given response
 func (s *session) addMailboxInfo(resp *response) error {
-	mailstore := s.config.Store
+	mailstore := s.store()
 
 	// Get the mailbox information from the mailstore
 	firstUnseen, err := mailstore.FirstUnseen(s.mailbox.Id)
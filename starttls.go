@@ -0,0 +1,46 @@
+package imapsrv
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+)
+
+// starttlsCommand is the STARTTLS command (RFC 3501 6.2.1)
+type starttlsCommand struct {
+	tag string
+}
+
+// createStarttls parses a STARTTLS command
+func (p *parser) createStarttls(tag string) (command, error) {
+	p.lexer.next(asAny) // consume the trailing EOL
+	return &starttlsCommand{tag: tag}, nil
+}
+
+func (c *starttlsCommand) execute(sess *session) *response {
+	if sess.tls {
+		return bad(c.tag, "TLS is already active")
+	}
+	if sess.config.TLSConfig == nil {
+		return no(c.tag, "STARTTLS is not available")
+	}
+	if sess.conn == nil {
+		return bad(c.tag, "STARTTLS requires a live connection")
+	}
+
+	// The tagged OK must be sent in cleartext before negotiation begins
+	fmt.Fprintf(sess.conn, "%s OK Begin TLS negotiation now\r\n", c.tag)
+
+	tlsConn := tls.Server(sess.conn, sess.config.TLSConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		sess.log("STARTTLS handshake failed: ", err)
+		tlsConn.Close()
+		return nil
+	}
+
+	sess.conn = tlsConn
+	sess.tls = true
+	sess.pendingReader = bufio.NewReader(tlsConn)
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package imapsrv
+
+import "testing"
+
+// TestStarttlsNotAvailable tests that STARTTLS is refused when the
+// server has no TLSConfig configured
+func TestStarttlsNotAvailable(t *testing.T) {
+	_, sess := setupTest()
+	cmd := &starttlsCommand{tag: "A01"}
+	resp := cmd.execute(sess)
+	if resp.status != statusNo {
+		t.Fatalf("expected STARTTLS to be refused without a TLSConfig, got %+v", resp)
+	}
+}
+
+// TestStarttlsAlreadyActive tests that STARTTLS is refused once the
+// session is already TLS-protected
+func TestStarttlsAlreadyActive(t *testing.T) {
+	_, sess := setupTest()
+	sess.tls = true
+	cmd := &starttlsCommand{tag: "A01"}
+	resp := cmd.execute(sess)
+	if resp.status != statusBad {
+		t.Fatalf("expected STARTTLS to be refused when already active, got %+v", resp)
+	}
+}
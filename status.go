@@ -0,0 +1,47 @@
+package imapsrv
+
+// StatusItem is a single data item STATUS can report about a mailbox
+type StatusItem int
+
+const (
+	StatusMessages StatusItem = iota
+	StatusRecent
+	StatusUIDNext
+	StatusUIDValidity
+	StatusUnseen
+)
+
+func (i StatusItem) String() string {
+	switch i {
+	case StatusMessages:
+		return "MESSAGES"
+	case StatusRecent:
+		return "RECENT"
+	case StatusUIDNext:
+		return "UIDNEXT"
+	case StatusUIDValidity:
+		return "UIDVALIDITY"
+	case StatusUnseen:
+		return "UNSEEN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// statusItemFor maps a STATUS command's item keyword to a StatusItem
+func statusItemFor(name string) (StatusItem, error) {
+	switch name {
+	case "MESSAGES":
+		return StatusMessages, nil
+	case "RECENT":
+		return StatusRecent, nil
+	case "UIDNEXT":
+		return StatusUIDNext, nil
+	case "UIDVALIDITY":
+		return StatusUIDValidity, nil
+	case "UNSEEN":
+		return StatusUnseen, nil
+	default:
+		return 0, parseError("Unknown STATUS item \"" + name + "\"")
+	}
+}